@@ -9,9 +9,16 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/exe"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
@@ -22,20 +29,36 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+// Minimum time between two progress lines, keeps the output readable in build logs.
+const progressInterval = 5 * time.Second
+
+var (
+	byteSizeRegex = regexp.MustCompile(`^(\d+)\s*(|B|K|KiB|M|MiB|G|GiB)$`)
+	sha256Regex   = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
 var (
 	app = kingpin.New("downloader", "Download files to a location")
 
 	logFlags  = exe.SetupLogFlags(app)
+	timeout   = exe.TimeoutFlag(app, "Maximum duration of the whole run, covering every URL (--mirror included) and all their retries. Use 0 for no limit.")
 	noClobber = app.Flag("no-clobber", "Do not overwrite existing files").Bool()
 	noVerbose = app.Flag("no-verbose", "Do not print verbose output").Bool()
 
-	caCertFile    = app.Flag("ca-certificate", "Root certificate authority to use when downloading files.").String()
-	tlsClientCert = app.Flag("certificate", "TLS client certificate to use when downloading files.").String()
-	tlsClientKey  = app.Flag("private-key", "TLS client key to use when downloading files.").String()
+	caCertFile     = app.Flag("ca-certificate", "Root certificate authority to use when downloading files.").String()
+	tlsClientCert  = app.Flag("certificate", "TLS client certificate to use when downloading files.").String()
+	tlsClientKey   = app.Flag("private-key", "TLS client key to use when downloading files.").String()
+	proxyUrl       = app.Flag("proxy", "Proxy to use for HTTP(S) downloads (e.g. 'http://proxy:3128'). Overrides the HTTP_PROXY/HTTPS_PROXY environment variables.").String()
+	maxRate        = app.Flag("max-rate", "Maximum download bandwidth per second (e.g. '500KiB', '10MiB'). Use 0 for no limit.").Default("0").String()
+	expectedSha256 = app.Flag("sha256", "Expected SHA-256 digest of the downloaded file. A download with a different digest is retried.").String()
+
+	downloadTimeout = app.Flag("download-timeout", "Maximum duration spent on each URL (the main URL and every --mirror separately), including its retries. Once it elapses the next mirror is tried. Use 0 for no limit.").Default(network.DefaultTimeout.String()).Duration()
+	stallTimeout    = app.Flag("stall-timeout", "Abort and retry an attempt if no data is received for this long. Use 0 to wait indefinitely.").Default(network.DefaultStallTimeout.String()).Duration()
 
 	dstFile   = app.Flag("output-file", "Destination file to download to").Short('O').String()
 	prefixDir = app.Flag("directory-prefix", "Directory to download to").Short('P').String()
 	srcUrl    = app.Arg("url", "URL to download").Required().String()
+	mirrors   = app.Flag("mirror", "Additional URL to download the same file from, tried in order if the previous URLs fail. May be repeated.").Strings()
 )
 
 func main() {
@@ -69,6 +92,15 @@ func main() {
 		tlsCerts = append(tlsCerts, cert)
 	}
 
+	maxBytesPerSecond, err := parseByteSize(*maxRate)
+	if err != nil {
+		logger.Log.Fatalf("Invalid --max-rate (%s), Error:\n%s", *maxRate, err)
+	}
+
+	if *expectedSha256 != "" && !sha256Regex.MatchString(*expectedSha256) {
+		logger.Log.Fatalf("Invalid --sha256 (%s), expected 64 hexadecimal characters", *expectedSha256)
+	}
+
 	// dst may be empty, in which case the file will be downloaded to the current directory. Generate dst from src's basename.
 	// The url may include query strings which should be stripped.
 	if *dstFile != "" && *prefixDir != "" {
@@ -92,13 +124,154 @@ func main() {
 			logger.Log.Fatalf("Failed to check if file (%s) exists. Error:\n%s", *dstFile, err)
 		}
 		if exists {
-			logger.Log.Infof("File (%s) already exists, skipping download", *dstFile)
-			return
+			if *expectedSha256 == "" || existingFileMatches(*dstFile, *expectedSha256) {
+				logger.Log.Infof("File (%s) already exists, skipping download", *dstFile)
+				return
+			}
+			logger.Log.Warnf("File (%s) already exists but does not match the expected SHA-256, downloading it again", *dstFile)
 		}
 	}
 
-	_, err = network.DownloadFileWithRetry(context.Background(), *srcUrl, *dstFile, caCerts, tlsCerts, network.DefaultTimeout)
+	downloadOptions := network.DownloadOptions{
+		StallTimeout:      *stallTimeout,
+		ProxyUrl:          *proxyUrl,
+		MaxBytesPerSecond: maxBytesPerSecond,
+		ExpectedSha256:    *expectedSha256,
+	}
+	if !*noVerbose {
+		downloadOptions.Progress = newProgressReporter(filepath.Base(*dstFile), os.Stderr)
+		downloadOptions.ProgressInterval = progressInterval
+	}
+	ctx, cancel := exe.ContextWithTimeout(*timeout)
+	defer cancel()
+
+	srcUrls := append([]string{*srcUrl}, *mirrors...)
+	_, err = network.DownloadFileFromMirrors(ctx, srcUrls, *dstFile, caCerts, tlsCerts, *downloadTimeout, downloadOptions)
 	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			logger.Log.Fatalf("Failed to download (%s) to (%s) within --timeout (%s)", *srcUrl, *dstFile, *timeout)
+		}
 		logger.Log.Fatalf("Failed to download (%s) to (%s). Error:\n%s", *srcUrl, *dstFile, err)
 	}
 }
+
+// existingFileMatches returns true if the file at path has the SHA-256 digest expectedSha256.
+func existingFileMatches(path, expectedSha256 string) bool {
+	actualSha256, err := file.GenerateSHA256(path)
+	if err != nil {
+		logger.Log.Warnf("Failed to hash existing file (%s). Error:\n%s", path, err)
+		return false
+	}
+
+	return strings.EqualFold(actualSha256, expectedSha256)
+}
+
+// newProgressReporter returns a network.ProgressFunc reporting the progress of downloading name. With JSON logging
+// the progress is logged as structured entries so the log stream stays parsable, otherwise it is printed to out.
+func newProgressReporter(name string, out io.Writer) network.ProgressFunc {
+	if logger.IsJsonFormat() {
+		return newProgressLogger(name)
+	}
+	return newProgressPrinter(name, out)
+}
+
+// newProgressPrinter returns a network.ProgressFunc which writes the download percentage and throughput to out.
+func newProgressPrinter(name string, out io.Writer) network.ProgressFunc {
+	measureThroughput := newThroughputMeter()
+
+	return func(bytesDownloaded, totalBytes int64) {
+		throughput := ""
+		if bytesPerSecond, ok := measureThroughput(bytesDownloaded); ok {
+			throughput = fmt.Sprintf(", %s/s", formatBytes(bytesPerSecond))
+		}
+
+		if totalBytes > 0 {
+			percent := float64(bytesDownloaded) * 100 / float64(totalBytes)
+			fmt.Fprintf(out, "%s: %5.1f%% (%s / %s)%s\n", name, percent, formatBytes(bytesDownloaded), formatBytes(totalBytes), throughput)
+		} else {
+			fmt.Fprintf(out, "%s: %s%s\n", name, formatBytes(bytesDownloaded), throughput)
+		}
+	}
+}
+
+// newProgressLogger returns a network.ProgressFunc which logs the download progress as fields of a log entry.
+// 'total' is -1 when the server did not report the size, 'bytes_per_second' is omitted until it can be measured.
+func newProgressLogger(name string) network.ProgressFunc {
+	measureThroughput := newThroughputMeter()
+
+	return func(bytesDownloaded, totalBytes int64) {
+		fields := logrus.Fields{
+			"file":  name,
+			"bytes": bytesDownloaded,
+			"total": totalBytes,
+		}
+		if bytesPerSecond, ok := measureThroughput(bytesDownloaded); ok {
+			fields["bytes_per_second"] = bytesPerSecond
+		}
+
+		logger.Log.WithFields(fields).Info("Download progress")
+	}
+}
+
+// newThroughputMeter returns a function which returns the throughput since its previous call. ok is false on the first
+// call and whenever the byte count went backwards, e.g. because a download restarted.
+func newThroughputMeter() func(bytesDownloaded int64) (bytesPerSecond int64, ok bool) {
+	var (
+		lastBytes int64
+		lastTime  time.Time
+	)
+
+	return func(bytesDownloaded int64) (bytesPerSecond int64, ok bool) {
+		now := time.Now()
+		if !lastTime.IsZero() && bytesDownloaded >= lastBytes {
+			elapsed := now.Sub(lastTime).Seconds()
+			if elapsed > 0 {
+				bytesPerSecond, ok = int64(float64(bytesDownloaded-lastBytes)/elapsed), true
+			}
+		}
+		lastBytes, lastTime = bytesDownloaded, now
+		return
+	}
+}
+
+// formatBytes returns a human readable representation of a byte count using binary units.
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes) / unit
+	i := 0
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// parseByteSize parses a byte count with an optional binary unit suffix (e.g. '10MiB' or '10M').
+func parseByteSize(size string) (bytes int64, err error) {
+	match := byteSizeRegex.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("(%s) has incorrect format, expected <NUM>[B|K|KiB|M|MiB|G|GiB]", size)
+	}
+
+	bytes, err = strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	switch match[2] {
+	case "K", "KiB":
+		bytes <<= 10
+	case "M", "MiB":
+		bytes <<= 20
+	case "G", "GiB":
+		bytes <<= 30
+	}
+
+	return bytes, nil
+}
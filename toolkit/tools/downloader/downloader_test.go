@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestProgressReporterText(t *testing.T) {
+	logger.InitStderrLog()
+
+	printed := &bytes.Buffer{}
+	progress := newProgressReporter("foo.rpm", printed)
+	progress(512, 1024)
+
+	assert.Equal(t, "foo.rpm:  50.0% (512 B / 1.0 KiB)\n", printed.String())
+}
+
+func TestProgressReporterJsonLogFormat(t *testing.T) {
+	logger.InitStderrLog()
+	logOutput := &bytes.Buffer{}
+	logger.ReplaceStderrWriter(logOutput)
+	assert.NoError(t, logger.SetLogFormat("json"))
+	defer logger.InitStderrLog()
+
+	printed := &bytes.Buffer{}
+	progress := newProgressReporter("foo.rpm", printed)
+	progress(512, 1024)
+	progress(1024, 1024)
+	logger.Log.Info("done")
+
+	// Nothing may bypass the logger, every stderr line must be a JSON object.
+	assert.Empty(t, printed.String())
+
+	entries := []map[string]interface{}{}
+	scanner := bufio.NewScanner(logOutput)
+	for scanner.Scan() {
+		entry := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry), "line is not JSON: %s", scanner.Text())
+		entries = append(entries, entry)
+	}
+
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, "Download progress", entries[0]["msg"])
+		assert.Equal(t, "foo.rpm", entries[0]["file"])
+		assert.Equal(t, float64(512), entries[0]["bytes"])
+		assert.Equal(t, float64(1024), entries[0]["total"])
+		assert.Equal(t, float64(1024), entries[1]["bytes"])
+		assert.Equal(t, "done", entries[2]["msg"])
+	}
+}
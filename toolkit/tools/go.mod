@@ -14,7 +14,9 @@ require (
 	github.com/gdamore/tcell v1.4.0
 	github.com/google/uuid v1.6.0
 	github.com/jinzhu/copier v0.3.2
+	github.com/jlaffaye/ftp v0.2.0
 	github.com/juliangruber/go-intersect v1.1.0
+	github.com/klauspost/compress v1.10.5
 	github.com/klauspost/pgzip v1.2.5
 	github.com/moby/sys/mountinfo v0.6.2
 	github.com/muesli/crunchy v0.4.0
@@ -23,6 +25,7 @@ require (
 	github.com/stretchr/testify v1.9.0
 	github.com/ulikunitz/xz v0.5.10
 	golang.org/x/sys v0.21.0
+	golang.org/x/time v0.5.0
 	gonum.org/v1/gonum v0.15.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/ini.v1 v1.67.0
@@ -38,7 +41,8 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gdamore/encoding v1.0.0 // indirect
 	github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
-	github.com/klauspost/compress v1.10.5 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.0.3 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
@@ -6,6 +6,7 @@
 package configuration
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -90,7 +91,7 @@ func (p *PackageRepo) IsValid() (err error) {
 
 // UpdatePackageRepo creates additional repo files specified by image configuration
 // and returns error if the operation fails
-func UpdatePackageRepo(installChroot *safechroot.Chroot, config SystemConfig) (err error) {
+func UpdatePackageRepo(ctx context.Context, installChroot *safechroot.Chroot, config SystemConfig) (err error) {
 	const (
 		repoFileDir   = "/etc/yum.repos.d/"
 		localRepoFile = "/etc/yum.repos.d/mariner-iso.repo"
@@ -130,8 +131,8 @@ func UpdatePackageRepo(installChroot *safechroot.Chroot, config SystemConfig) (e
 	}
 
 	// It is possible that network access may not be up at this point,
-	// so check network access
-	err, hasNetworkAccess := network.CheckNetworkAccess()
+	// so check network access. Cancelling ctx stops the wait.
+	err, hasNetworkAccess := network.CheckNetworkAccess(ctx)
 	if err != nil {
 		return
 	}
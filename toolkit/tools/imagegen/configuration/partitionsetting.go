@@ -10,6 +10,10 @@ import (
 	"fmt"
 )
 
+// RdiffTargetChecksumExtension is appended to the path of an rdiff artifact to get the file holding the SHA256
+// checksum of the partition the delta reconstructs. The imager writes it and roast uses it to verify the delta.
+const RdiffTargetChecksumExtension = ".target.sha256"
+
 // PartitionSetting holds the mounting information for each partition.
 type PartitionSetting struct {
 	RemoveDocs       bool            `json:"RemoveDocs"`
@@ -2752,7 +2752,7 @@ func setGrubCfgRootDevice(rootDevice, grubPath, luksUUID string) (err error) {
 // - systemConfig system configration corresponding to the disk configuration
 // - partIDToDevPathMap is a map of partition IDs to partition device paths
 // - mountPointToOverlayMap is a map of mountpoints to the overlay details for this mount if any
-func ExtractPartitionArtifacts(setupChrootDirPath, workDirPath string, diskIndex int, disk configuration.Disk, systemConfig configuration.SystemConfig, partIDToDevPathMap map[string]string, mountPointToOverlayMap map[string]*Overlay) (err error) {
+func ExtractPartitionArtifacts(setupChrootDirPath, workDirPath string, diskIndex int, disk configuration.Disk, systemConfig configuration.SystemConfig, partIDToDevPathMap map[string]string, mountPointToOverlayMap map[string]*Overlay, rdiffTargetChecksums bool) (err error) {
 	timestamp.StartEvent("create partition artifacts", nil)
 	defer timestamp.StopEvent(nil)
 
@@ -2792,7 +2792,7 @@ func ExtractPartitionArtifacts(setupChrootDirPath, workDirPath string, diskIndex
 						if setting.RdiffBaseImage != "" {
 							// Diff artifact type output
 							finalName := fmt.Sprintf("disk%d.partition%d.rdiff", diskIndex, i)
-							err = createRDiffArtifact(workDirPath, devPath, setting.RdiffBaseImage, finalName)
+							err = createRDiffArtifact(workDirPath, devPath, setting.RdiffBaseImage, finalName, rdiffTargetChecksums)
 						}
 						break
 					}
@@ -2838,7 +2838,10 @@ func createRawArtifact(workDirPath, devPath, name string) (err error) {
 	return shell.ExecuteLive(squashErrors, "dd", ddArgs...)
 }
 
-func createRDiffArtifact(workDirPath, devPath, rDiffBaseImage, name string) (err error) {
+// createRDiffArtifact writes an rdiff delta from rDiffBaseImage to the partition at devPath. If writeTargetChecksum is
+// set, the SHA256 checksum of the partition is also written next to the delta so it can be verified later. This reads
+// the whole partition a second time.
+func createRDiffArtifact(workDirPath, devPath, rDiffBaseImage, name string, writeTargetChecksum bool) (err error) {
 	const (
 		signatureFileName = "./signature"
 		squashErrors      = true
@@ -2868,7 +2871,18 @@ func createRDiffArtifact(workDirPath, devPath, rDiffBaseImage, name string) (err
 		fullPath,
 	}
 
-	return shell.ExecuteLive(squashErrors, "rdiff", rdiffArgs...)
+	err = shell.ExecuteLive(squashErrors, "rdiff", rdiffArgs...)
+	if err != nil || !writeTargetChecksum {
+		return
+	}
+
+	targetHash, err := file.GenerateSHA256(devPath)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum of (%s):\n%w", devPath, err)
+	}
+
+	checksumLine := fmt.Sprintf("%s  %s\n", targetHash, filepath.Base(devPath))
+	return file.Write(checksumLine, fullPath+configuration.RdiffTargetChecksumExtension)
 }
 
 // KernelPackages returns a list of kernel packages obtained from KernelOptions in the config's SystemConfigs
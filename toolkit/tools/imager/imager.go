@@ -6,8 +6,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 
@@ -23,6 +25,7 @@ import (
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/timestamp"
 	"github.com/microsoft/azurelinux/toolkit/tools/pkg/profile"
 
+	"golang.org/x/sys/unix"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -42,6 +45,7 @@ var (
 	timestampFile    = app.Flag("timestamp-file", "File that stores timestamps for this program.").String()
 	buildNumber      = app.Flag("build-number", "Build number to be used in the image.").String()
 	repoSnapshotTime = app.Flag("repo-snapshot-time", "Optional: Snapshot time to be added to the image tdnf.conf").String()
+	rdiffChecksums   = app.Flag("rdiff-target-checksums", "Write the SHA256 checksum of each rdiff artifact's partition next to the delta, for 'roast --verify-deltas'. Reads every such partition a second time.").Bool()
 	logFlags         = exe.SetupLogFlags(app)
 	profFlags        = exe.SetupProfileFlags(app)
 )
@@ -281,7 +285,7 @@ func buildSystemConfig(systemConfig configuration.SystemConfig, disks []configur
 		}
 
 		// Create any partition-based artifacts
-		err = installutils.ExtractPartitionArtifacts(setupChrootDir, outputDir, defaultDiskIndex, disks[defaultDiskIndex], systemConfig, partIDToDevPathMap, mountPointToOverlayMap)
+		err = installutils.ExtractPartitionArtifacts(setupChrootDir, outputDir, defaultDiskIndex, disks[defaultDiskIndex], systemConfig, partIDToDevPathMap, mountPointToOverlayMap, *rdiffChecksums)
 		if err != nil {
 			return
 		}
@@ -567,7 +571,10 @@ func buildImage(mountPointMap, mountPointToFsTypeMap, mountPointToMountArgsMap,
 	// Update package repo files for upcoming package installation
 	if len(systemConfig.PackageRepos) > 0 {
 		if systemConfig.IsIsoInstall {
-			err = configuration.UpdatePackageRepo(installChroot, systemConfig)
+			// Let an interrupt stop the wait for network access instead of blocking until it gives up.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, unix.SIGTERM)
+			err = configuration.UpdatePackageRepo(ctx, installChroot, systemConfig)
+			stop()
 			if err != nil {
 				return
 			}
@@ -4,13 +4,19 @@
 package directory
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
-	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"golang.org/x/sys/unix"
 )
 
 // LastModifiedFile returns the timestamp and path to the file last modified inside a directory.
@@ -33,11 +39,20 @@ func LastModifiedFile(dirPath string) (modTime time.Time, latestFile string, err
 	return
 }
 
-// CopyContents will recursively copy the contents of srcDir into dstDir.
+// CopyContents will recursively copy the contents of srcDir into dstDir, keeping the same metadata as 'cp -a'.
 // - It will create dstDir if it does not already exist.
+// - Entries keep their permissions (including setuid/setgid), extended attributes and modification times.
+// - Symlinks are recreated as-is, hard links inside srcDir are recreated as hard links.
+// - Device nodes, FIFOs and sockets are recreated, creating device nodes requires root.
+// - Ownership is preserved when running as root.
 func CopyContents(srcDir, dstDir string) (err error) {
-	const squashErrors = false
+	return CopyContentsFiltered(srcDir, dstDir, nil)
+}
 
+// CopyContentsFiltered behaves like CopyContents, but calls skip (if not nil) with the path of each entry relative to
+// srcDir before copying it. Entries for which skip returns true are not copied; for a directory this prunes
+// everything beneath it.
+func CopyContentsFiltered(srcDir, dstDir string, skip func(relPath string, info os.FileInfo) bool) (err error) {
 	isSrcDir, err := file.IsDir(srcDir)
 	if err != nil {
 		return err
@@ -52,28 +67,268 @@ func CopyContents(srcDir, dstDir string) (err error) {
 		return
 	}
 
-	fds, err := os.ReadDir(srcDir)
+	// Directory modification times are updated as their contents are copied, so only restore them once the walk is done.
+	copiedDirs := []copiedDir{}
+	links := hardLinks{}
+
+	err = filepath.WalkDir(srcDir, func(srcPath string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		if srcPath == srcDir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(srcDir, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dstDir, relPath)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if skip != nil && skip(relPath, info) {
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		err = copyEntry(srcPath, dstPath, info, links)
+		if err != nil {
+			return fmt.Errorf("failed to copy (%s) to (%s):\n%w", srcPath, dstPath, err)
+		}
+
+		if info.IsDir() {
+			copiedDirs = append(copiedDirs, copiedDir{path: dstPath, modTime: info.ModTime()})
+		}
+
+		return nil
+	})
 	if err != nil {
 		return
 	}
 
-	for _, fd := range fds {
-		srcPath := filepath.Join(srcDir, fd.Name())
-		dstPath := filepath.Join(dstDir, fd.Name())
+	for i := len(copiedDirs) - 1; i >= 0; i-- {
+		err = setModTime(copiedDirs[i].path, copiedDirs[i].modTime)
+		if err != nil {
+			return fmt.Errorf("failed to set modification time of (%s):\n%w", copiedDirs[i].path, err)
+		}
+	}
+
+	return
+}
+
+type copiedDir struct {
+	path    string
+	modTime time.Time
+}
 
-		cpArgs := []string{"-a", srcPath, dstPath}
-		if fd.IsDir() {
-			cpArgs = append([]string{"-r"}, cpArgs...)
+// inode identifies a file on the host.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinks maps each source file with several links to its first copy, the other links are linked to that copy.
+type hardLinks map[inode]string
+
+// copyEntry copies a single entry described by info from srcPath to dstPath, along with its metadata. Directories
+// are created empty, their contents are copied separately.
+func copyEntry(srcPath, dstPath string, info fs.FileInfo, links hardLinks) (err error) {
+	mode := info.Mode()
+	stat, _ := info.Sys().(*syscall.Stat_t)
+
+	if !mode.IsDir() && stat != nil && stat.Nlink > 1 {
+		key := inode{dev: uint64(stat.Dev), ino: stat.Ino}
+		if firstCopy, ok := links[key]; ok {
+			return linkFile(firstCopy, dstPath)
+		}
+		links[key] = dstPath
+	}
+
+	switch {
+	case mode.IsDir():
+		err = os.MkdirAll(dstPath, mode.Perm())
+	case mode&fs.ModeSymlink != 0:
+		err = copySymlink(srcPath, dstPath)
+	case mode.IsRegular():
+		err = copyRegularFile(srcPath, dstPath, info)
+	case mode&(fs.ModeDevice|fs.ModeNamedPipe|fs.ModeSocket) != 0 && stat != nil:
+		err = copySpecialFile(dstPath, stat)
+	default:
+		return fmt.Errorf("unsupported file type (%s)", mode.Type())
+	}
+	if err != nil {
+		return
+	}
+
+	return copyMetadata(srcPath, dstPath, info, stat)
+}
+
+// copyMetadata gives dstPath the ownership, mode, extended attributes and modification time of srcPath. Changing
+// the owner clears the setuid/setgid bits and file capabilities, so it must happen before the mode and extended
+// attributes are set. Directory modification times are left to the caller.
+func copyMetadata(srcPath, dstPath string, info fs.FileInfo, stat *syscall.Stat_t) (err error) {
+	// Only root may change a file's owner.
+	if os.Geteuid() == 0 && stat != nil {
+		err = os.Lchown(dstPath, int(stat.Uid), int(stat.Gid))
+		if err != nil {
+			return
 		}
+	}
 
-		err = shell.ExecuteLive(squashErrors, "cp", cpArgs...)
+	// Symlinks have no mode of their own. Creating the other entries is subject to the umask and leaves existing
+	// entries alone, so set the mode explicitly.
+	if info.Mode()&fs.ModeSymlink == 0 {
+		err = os.Chmod(dstPath, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky))
 		if err != nil {
 			return
 		}
 	}
+
+	err = copyXattrs(srcPath, dstPath)
+	if err != nil {
+		return
+	}
+
+	if info.IsDir() {
+		return
+	}
+
+	return setModTime(dstPath, info.ModTime())
+}
+
+func copySymlink(srcPath, dstPath string) (err error) {
+	target, err := os.Readlink(srcPath)
+	if err != nil {
+		return
+	}
+
+	err = file.RemoveFileIfExists(dstPath)
+	if err != nil {
+		return
+	}
+
+	return os.Symlink(target, dstPath)
+}
+
+func copyRegularFile(srcPath, dstPath string, info fs.FileInfo) (err error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return
+	}
+
+	_, err = io.Copy(dst, src)
+	closeErr := dst.Close()
+	if err != nil {
+		return
+	}
+
+	return closeErr
+}
+
+// copySpecialFile recreates the device node, FIFO or socket described by stat at dstPath.
+func copySpecialFile(dstPath string, stat *syscall.Stat_t) (err error) {
+	err = file.RemoveFileIfExists(dstPath)
+	if err != nil {
+		return
+	}
+
+	return unix.Mknod(dstPath, stat.Mode, int(stat.Rdev))
+}
+
+// linkFile makes dstPath a hard link to the already copied file firstCopy.
+func linkFile(firstCopy, dstPath string) (err error) {
+	err = file.RemoveFileIfExists(dstPath)
+	if err != nil {
+		return
+	}
+
+	return os.Link(firstCopy, dstPath)
+}
+
+// copyXattrs copies the extended attributes of srcPath, such as SELinux labels and file capabilities, to dstPath
+// without following symlinks. Like 'cp -a', attributes the filesystem or the current user can't set are skipped.
+func copyXattrs(srcPath, dstPath string) (err error) {
+	names, err := listXattrs(srcPath)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list extended attributes:\n%w", err)
+	}
+
+	for _, name := range names {
+		var value []byte
+		value, err = getXattr(srcPath, name)
+		if err != nil {
+			return fmt.Errorf("failed to read extended attribute (%s):\n%w", name, err)
+		}
+
+		err = unix.Lsetxattr(dstPath, name, value, 0)
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+			logger.Log.Debugf("Skipping extended attribute (%s) of (%s): %s", name, dstPath, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set extended attribute (%s):\n%w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// listXattrs returns the names of the extended attributes of path, without following symlinks.
+func listXattrs(path string) (names []string, err error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		return
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return
+	}
+
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
 	return
 }
 
+// getXattr returns the value of the extended attribute name of path, without following symlinks.
+func getXattr(path, name string) (value []byte, err error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return
+	}
+
+	value = make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, value)
+	value = value[:max(size, 0)]
+	return
+}
+
+// setModTime sets the access and modification times of path to modTime, without following symlinks.
+func setModTime(path string, modTime time.Time) error {
+	timestamp := unix.NsecToTimespec(modTime.UnixNano())
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, []unix.Timespec{timestamp, timestamp}, unix.AT_SYMLINK_NOFOLLOW)
+}
+
 func EnsureDirExists(dirName string) (err error) {
 	_, err = os.Stat(dirName)
 	if err == nil {
@@ -0,0 +1,287 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package directory
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestCopyContentsNestedDirs(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+
+	err := os.MkdirAll(filepath.Join(srcDir, "a", "b", "c"), 0o755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "top"), []byte("top"), 0o644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "a", "b", "c", "nested"), []byte("nested"), 0o644)
+	assert.NoError(t, err)
+	err = os.Mkdir(filepath.Join(srcDir, "empty"), 0o755)
+	assert.NoError(t, err)
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dstDir, "top"))
+	assert.NoError(t, err)
+	assert.Equal(t, "top", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dstDir, "a", "b", "c", "nested"))
+	assert.NoError(t, err)
+	assert.Equal(t, "nested", string(data))
+
+	assert.DirExists(t, filepath.Join(dstDir, "empty"))
+}
+
+func TestCopyContentsSymlinks(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	err := os.Mkdir(filepath.Join(srcDir, "dir"), 0o755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "dir", "file"), []byte("file"), 0o644)
+	assert.NoError(t, err)
+	err = os.Symlink("dir/file", filepath.Join(srcDir, "filelink"))
+	assert.NoError(t, err)
+	err = os.Symlink("dir", filepath.Join(srcDir, "dirlink"))
+	assert.NoError(t, err)
+	err = os.Symlink("/does/not/exist", filepath.Join(srcDir, "dangling"))
+	assert.NoError(t, err)
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	for link, expectedTarget := range map[string]string{"filelink": "dir/file", "dirlink": "dir", "dangling": "/does/not/exist"} {
+		target, err := os.Readlink(filepath.Join(dstDir, link))
+		assert.NoError(t, err)
+		assert.Equal(t, expectedTarget, target)
+	}
+}
+
+func TestCopyContentsPreservesPermissionsAndTimes(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	modTime := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	oldUmask := syscall.Umask(0o077)
+	defer syscall.Umask(oldUmask)
+
+	executable := filepath.Join(srcDir, "executable")
+	err := os.WriteFile(executable, []byte("#!/bin/sh"), 0o755)
+	assert.NoError(t, err)
+	err = os.Chmod(executable, 0o755)
+	assert.NoError(t, err)
+	err = os.Chtimes(executable, modTime, modTime)
+	assert.NoError(t, err)
+
+	subDir := filepath.Join(srcDir, "subdir")
+	err = os.Mkdir(subDir, 0o750)
+	assert.NoError(t, err)
+	err = os.Chmod(subDir, 0o750)
+	assert.NoError(t, err)
+	err = os.Chtimes(subDir, modTime, modTime)
+	assert.NoError(t, err)
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(dstDir, "executable"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	assert.True(t, modTime.Equal(info.ModTime()))
+
+	info, err = os.Stat(filepath.Join(dstDir, "subdir"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+	assert.True(t, modTime.Equal(info.ModTime()))
+}
+
+func TestCopyContentsOverwritesExistingFiles(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	err := os.WriteFile(filepath.Join(srcDir, "file"), []byte("new"), 0o644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dstDir, "file"), []byte("old contents"), 0o644)
+	assert.NoError(t, err)
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dstDir, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestCopyContentsRequiresDirectory(t *testing.T) {
+	srcFile := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(srcFile, []byte("file"), 0o644)
+	assert.NoError(t, err)
+
+	err = CopyContents(srcFile, t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestCopyContentsFilteredSkipsSubdirectory(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	for _, dir := range []string{"proc/1", "var/cache/dnf", "var/lib"} {
+		err := os.MkdirAll(filepath.Join(srcDir, dir), 0o755)
+		assert.NoError(t, err)
+		err = os.WriteFile(filepath.Join(srcDir, dir, "file"), []byte(dir), 0o644)
+		assert.NoError(t, err)
+	}
+
+	skipped := []string{}
+	err := CopyContentsFiltered(srcDir, dstDir, func(relPath string, info os.FileInfo) bool {
+		if relPath == "proc" || relPath == filepath.Join("var", "cache") {
+			skipped = append(skipped, relPath)
+			return true
+		}
+		return false
+	})
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"proc", filepath.Join("var", "cache")}, skipped)
+	assert.NoDirExists(t, filepath.Join(dstDir, "proc"))
+	assert.NoDirExists(t, filepath.Join(dstDir, "var", "cache"))
+	assert.FileExists(t, filepath.Join(dstDir, "var", "lib", "file"))
+}
+
+func TestCopyContentsFilteredSkipsFile(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	for _, name := range []string{"keep", "skip.tmp"} {
+		err := os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0o644)
+		assert.NoError(t, err)
+	}
+
+	err := CopyContentsFiltered(srcDir, dstDir, func(relPath string, info os.FileInfo) bool {
+		return filepath.Ext(relPath) == ".tmp"
+	})
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dstDir, "keep"))
+	assert.NoFileExists(t, filepath.Join(dstDir, "skip.tmp"))
+}
+
+func TestCopyContentsPreservesSetuidWithOwnership(t *testing.T) {
+	const (
+		uid = 1234
+		gid = 5678
+	)
+	if os.Geteuid() != 0 {
+		t.Skip("Test requires root to change file ownership")
+	}
+
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	setuidFile := filepath.Join(srcDir, "su")
+	err := os.WriteFile(setuidFile, []byte("#!/bin/sh"), 0o755)
+	assert.NoError(t, err)
+	err = os.Chown(setuidFile, uid, gid)
+	assert.NoError(t, err)
+	err = os.Chmod(setuidFile, 0o755|os.ModeSetuid|os.ModeSetgid)
+	assert.NoError(t, err)
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(dstDir, "su"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0o755|os.ModeSetuid|os.ModeSetgid, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid))
+
+	stat := info.Sys().(*syscall.Stat_t)
+	assert.Equal(t, uint32(uid), stat.Uid)
+	assert.Equal(t, uint32(gid), stat.Gid)
+}
+
+func TestCopyContentsPreservesXattrs(t *testing.T) {
+	const (
+		xattrName  = "user.directory-test"
+		xattrValue = "label"
+	)
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	err := os.Mkdir(filepath.Join(srcDir, "dir"), 0o755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "file"), []byte("file"), 0o644)
+	assert.NoError(t, err)
+
+	for _, name := range []string{"dir", "file"} {
+		err = unix.Setxattr(filepath.Join(srcDir, name), xattrName, []byte(xattrValue), 0)
+		if err != nil {
+			t.Skipf("Test requires user extended attribute support: %s", err)
+		}
+	}
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	for _, name := range []string{"dir", "file"} {
+		value := make([]byte, len(xattrValue))
+		_, err = unix.Getxattr(filepath.Join(dstDir, name), xattrName, value)
+		assert.NoError(t, err)
+		assert.Equal(t, xattrValue, string(value))
+	}
+}
+
+func TestCopyContentsPreservesHardLinks(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	err := os.Mkdir(filepath.Join(srcDir, "sub"), 0o755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "first"), []byte("shared"), 0o644)
+	assert.NoError(t, err)
+	err = os.Link(filepath.Join(srcDir, "first"), filepath.Join(srcDir, "sub", "second"))
+	assert.NoError(t, err)
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	first, err := os.Stat(filepath.Join(dstDir, "first"))
+	assert.NoError(t, err)
+	second, err := os.Stat(filepath.Join(dstDir, "sub", "second"))
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(first, second))
+}
+
+func TestCopyContentsSpecialFiles(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	err := unix.Mkfifo(filepath.Join(srcDir, "fifo"), 0o600)
+	assert.NoError(t, err)
+
+	// /dev/null, only root may create device nodes.
+	nullDevice := unix.Mkdev(1, 3)
+	isRoot := os.Geteuid() == 0
+	if isRoot {
+		err = unix.Mknod(filepath.Join(srcDir, "null"), unix.S_IFCHR|0o666, int(nullDevice))
+		assert.NoError(t, err)
+	}
+
+	err = CopyContents(srcDir, dstDir)
+	assert.NoError(t, err)
+
+	info, err := os.Lstat(filepath.Join(dstDir, "fifo"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeNamedPipe, info.Mode().Type())
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	if isRoot {
+		info, err = os.Lstat(filepath.Join(dstDir, "null"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.ModeDevice|os.ModeCharDevice, info.Mode().Type())
+		assert.Equal(t, nullDevice, info.Sys().(*syscall.Stat_t).Rdev)
+	}
+}
@@ -5,8 +5,10 @@
 package exe
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -46,11 +48,27 @@ func OutputDirFlag(k *kingpin.Application, doc string) *string {
 	return k.Flag("output-dir", doc).Required().String()
 }
 
+// TimeoutFlag registers a timeout flag for k with documentation doc which limits how long the whole tool may run and
+// returns the passed value. A value of 0 means no limit.
+func TimeoutFlag(k *kingpin.Application, doc string) *time.Duration {
+	return k.Flag("timeout", doc).Default("0").Duration()
+}
+
+// ContextWithTimeout returns a context which is cancelled once timeout elapses, or only when cancel is called if timeout
+// is 0. Intended to be used with the value of TimeoutFlag.
+func ContextWithTimeout(timeout time.Duration) (ctx context.Context, cancel context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
 func SetupLogFlags(k *kingpin.Application) *logger.LogFlags {
 	lf := &logger.LogFlags{}
 	lf.LogColor = k.Flag(logger.ColorFlag, logger.ColorFlagHelp).PlaceHolder(logger.ColorsPlaceholder).Enum(logger.Colors()...)
 	lf.LogFile = k.Flag(logger.FileFlag, logger.FileFlagHelp).String()
 	lf.LogLevel = k.Flag(logger.LevelsFlag, logger.LevelsHelp).PlaceHolder(logger.LevelsPlaceholder).Enum(logger.Levels()...)
+	lf.LogFormat = k.Flag(logger.FormatFlag, logger.FormatFlagHelp).PlaceHolder(logger.FormatsPlaceholder).Enum(logger.Formats()...)
 	return lf
 }
 
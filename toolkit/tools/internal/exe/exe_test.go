@@ -1,9 +1,12 @@
 package exe
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 func TestParseListArgument(t *testing.T) {
@@ -56,3 +59,35 @@ func TestParseListArgument(t *testing.T) {
 		})
 	}
 }
+
+func TestTimeoutFlag(t *testing.T) {
+	app := kingpin.New("test", "")
+	timeout := TimeoutFlag(app, "")
+
+	_, err := app.Parse([]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), *timeout)
+
+	_, err = app.Parse([]string{"--timeout", "90s"})
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, *timeout)
+}
+
+func TestContextWithTimeout(t *testing.T) {
+	ctx, cancel := ContextWithTimeout(time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+func TestContextWithTimeoutNoLimit(t *testing.T) {
+	ctx, cancel := ContextWithTimeout(0)
+
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+	assert.NoError(t, ctx.Err())
+
+	cancel()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
@@ -25,11 +25,20 @@ var (
 	stderrHook *writerHook
 	fileHook   *writerHook
 
+	// toolName is the name of the running tool, included in every JSON log entry
+	toolName string
+
+	// jsonFormat is set once SetLogFormat switched the output to JSON
+	jsonFormat bool
+
 	// Valid log levels
 	levelsArray = []string{"panic", "fatal", "error", "warn", "info", "debug", "trace"}
 
 	// Valid log colors
 	colorsArray = []string{"always", "auto", "never"}
+
+	// Valid log formats
+	formatsArray = []string{"text", "json"}
 )
 
 const (
@@ -57,18 +66,31 @@ const (
 	// ColorFlagHelp is the suggested help message for the logcolor flag
 	ColorFlagHelp = "Color setting for log terminal output."
 
+	// FormatsPlaceholder are all valid log formats separated by '|' character.
+	FormatsPlaceholder = "(text|json)"
+
+	// FormatFlag is the suggested name for the logformat flag
+	FormatFlag = "log-format"
+
+	// FormatFlagHelp is the suggested help message for the logformat flag
+	FormatFlagHelp = "Format of the log output, 'json' writes one JSON object per entry for log aggregation."
+
 	defaultLogFileLevel   = logrus.DebugLevel
 	defaultStderrLogLevel = logrus.InfoLevel
 	parentCallerLevel     = 1
 	colorModeAuto         = "auto"
 	colorModeAlways       = "always"
 	colorModeNever        = "never"
+	formatText            = "text"
+	formatJson            = "json"
+	toolNameJsonKey       = "tool"
 )
 
 type LogFlags struct {
-	LogColor *string
-	LogFile  *string
-	LogLevel *string
+	LogColor  *string
+	LogFile   *string
+	LogLevel  *string
+	LogFormat *string
 }
 
 // initLogFile initializes the common logger with a file
@@ -140,6 +162,35 @@ func InitBestEffort(lf *LogFlags) {
 	}
 
 	PanicOnError(SetStderrLogLevel(level), "Failed while setting log level.")
+
+	if lf.LogFormat != nil {
+		PanicOnError(SetLogFormat(*lf.LogFormat), "Failed while setting log format.")
+	}
+}
+
+// SetLogFormat sets the format of both the stderr and file output. 'text' (or an empty string) keeps the default
+// human readable format, 'json' writes each entry as a JSON object with 'level', 'time', 'msg' and 'tool' keys.
+func SetLogFormat(format string) (err error) {
+	switch format {
+	case "", formatText:
+		return
+	case formatJson:
+		for _, hook := range []*writerHook{stderrHook, fileHook} {
+			if hook != nil {
+				hook.useJsonFormat(toolName)
+			}
+		}
+		jsonFormat = true
+		return
+	default:
+		return fmt.Errorf("unknown log format (%s), valid formats are %v", format, formatsArray)
+	}
+}
+
+// IsJsonFormat returns true if the log output is written as JSON. Tools writing their own output directly to stderr
+// should route it through Log instead so the stream stays parsable.
+func IsJsonFormat() bool {
+	return jsonFormat
 }
 
 // Levels returns list of strings representing valid log levels.
@@ -152,6 +203,11 @@ func Colors() []string {
 	return colorsArray
 }
 
+// Formats returns list of strings representing valid log formats.
+func Formats() []string {
+	return formatsArray
+}
+
 // PanicOnError logs the error and any message strings and then panics
 func PanicOnError(err interface{}, args ...interface{}) {
 	if err != nil {
@@ -202,7 +258,8 @@ func initStderrLogInternal(callerFilePath string, color string) {
 	Log = logrus.New()
 	Log.ReportCaller = true
 
-	toolName := strings.TrimSuffix(filepath.Base(callerFilePath), ".go")
+	toolName = strings.TrimSuffix(filepath.Base(callerFilePath), ".go")
+	jsonFormat = false
 
 	// By default send all log messages through stderrHook
 	stderrHook = newWriterHook(os.Stderr, defaultStderrLogLevel, useColors, toolName)
@@ -6,6 +6,8 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -131,3 +133,46 @@ func TestFormatWarningBox(t *testing.T) {
 		})
 	}
 }
+
+func TestSetLogFormatJson(t *testing.T) {
+	InitStderrLog()
+	output := &bytes.Buffer{}
+	ReplaceStderrWriter(output)
+
+	err := SetLogFormat("json")
+	assert.NoError(t, err)
+	assert.True(t, IsJsonFormat())
+
+	Log.WithField("package", "foo").Info("hello")
+
+	entry := map[string]interface{}{}
+	err = json.Unmarshal(output.Bytes(), &entry)
+	assert.NoError(t, err)
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "hello", entry["msg"])
+	assert.Equal(t, "log_test", entry["tool"])
+	assert.Equal(t, "foo", entry["package"])
+	assert.Contains(t, entry, "time")
+	assert.NotContains(t, entry, "file")
+	assert.NotContains(t, entry, "func")
+}
+
+func TestSetLogFormatText(t *testing.T) {
+	InitStderrLog()
+	output := &bytes.Buffer{}
+	ReplaceStderrWriter(output)
+
+	err := SetLogFormat("text")
+	assert.NoError(t, err)
+	assert.False(t, IsJsonFormat())
+
+	Log.Info("hello")
+	assert.Contains(t, output.String(), "[log_test] hello")
+}
+
+func TestSetLogFormatInvalid(t *testing.T) {
+	InitStderrLog()
+
+	err := SetLogFormat("xml")
+	assert.Error(t, err)
+}
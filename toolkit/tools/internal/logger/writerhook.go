@@ -57,6 +57,43 @@ func newWriterHook(writer io.Writer, level logrus.Level, useColors bool, toolNam
 	}
 }
 
+// jsonFormatter formats entries as JSON objects, adding the name of the tool which logged them
+type jsonFormatter struct {
+	logrus.JSONFormatter
+	toolName string
+}
+
+// newJsonFormatter returns a JSON formatter which tags every entry with toolName
+func newJsonFormatter(toolName string) *jsonFormatter {
+	return &jsonFormatter{
+		JSONFormatter: logrus.JSONFormatter{
+			FieldMap: logrus.FieldMap{
+				logrus.FieldKeyLevel: "level",
+				logrus.FieldKeyTime:  "time",
+				logrus.FieldKeyMsg:   "msg",
+			},
+			// Omit the caller's function and file, the tool name identifies the source.
+			CallerPrettyfier: func(frame *runtime.Frame) (function string, file string) {
+				return
+			},
+		},
+		toolName: toolName,
+	}
+}
+
+// Format formats the entry as a single line JSON object
+func (f *jsonFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+1)
+	for key, value := range entry.Data {
+		data[key] = value
+	}
+	data[toolNameJsonKey] = f.toolName
+
+	taggedEntry := *entry
+	taggedEntry.Data = data
+	return f.JSONFormatter.Format(&taggedEntry)
+}
+
 // Fire writes the log entry to the writer
 func (h *writerHook) Fire(entry *logrus.Entry) (err error) {
 	// Filter out entries that are at a higher level (more verbose) than the current filter
@@ -64,13 +101,13 @@ func (h *writerHook) Fire(entry *logrus.Entry) (err error) {
 		return
 	}
 
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
 	if !h.useColors {
 		entry.Message = colorCodeRegex.ReplaceAllString(entry.Message, "")
 	}
 
-	h.lock.Lock()
-	defer h.lock.Unlock()
-
 	msg, err := h.formatter.Format(entry)
 	if err != nil {
 		return
@@ -112,6 +149,15 @@ func (h *writerHook) ReplaceFormatter(newFormatter logrus.Formatter) (oldFormatt
 	return
 }
 
+// useJsonFormat switches the hook to JSON output. Color codes are always stripped from JSON messages.
+func (h *writerHook) useJsonFormat(toolName string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.formatter = newJsonFormatter(toolName)
+	h.useColors = false
+}
+
 // CurrentLevel returns the current log level for the hook
 func (h *writerHook) CurrentLevel() logrus.Level {
 	return h.level
@@ -0,0 +1,123 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"sync"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+)
+
+const (
+	defaultFtpPort     = "21"
+	anonymousFtpUser   = "anonymous"
+	anonymousFtpPasswd = "anonymous"
+)
+
+// downloadFtpToFile retrieves the file referenced by the ftp:// URL `srcUrl` into `dst`. Credentials are taken from
+// the URL if present, otherwise an anonymous login is used. If options.Resume is set and the server reports the file's
+// size, only the data missing from a partial `dst` is retrieved.
+// returns: partialUsable: true if `dst` holds a valid prefix of the download which may be resumed after an error.
+func downloadFtpToFile(srcUrl *url.URL, dst string, transfer transferOptions) (partialUsable bool, err error) {
+	ctx := transfer.ctx
+
+	address := srcUrl.Host
+	if srcUrl.Port() == "" {
+		address = net.JoinHostPort(srcUrl.Hostname(), defaultFtpPort)
+	}
+
+	// The ftp client only honors a context while connecting. Track both the control and data connections so they can
+	// be closed to abort a transfer in progress when the context is cancelled.
+	conns := &ftpConnTracker{}
+	stopAfterFunc := context.AfterFunc(ctx, conns.closeAll)
+	defer stopAfterFunc()
+
+	conn, err := ftp.Dial(address, ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+		return conns.dial(ctx, network, address)
+	}))
+	if err != nil {
+		return false, fmt.Errorf("%w:\nfailed to connect to (%s):\n%w", ErrDownloadFileOther, address, err)
+	}
+	defer conn.Quit()
+
+	user, password := anonymousFtpUser, anonymousFtpPasswd
+	if srcUrl.User != nil {
+		user = srcUrl.User.Username()
+		password, _ = srcUrl.User.Password()
+	}
+
+	err = conn.Login(user, password)
+	if err != nil {
+		return false, fmt.Errorf("%w:\nfailed to log in to (%s) as (%s):\n%w", ErrDownloadFileOther, address, user, err)
+	}
+
+	expectedSize, err := conn.FileSize(srcUrl.Path)
+	if err != nil {
+		if isFtpFileUnavailable(err) {
+			return false, fmt.Errorf("%w:\n%w", ErrDownloadFileInvalidResponse404, err)
+		}
+		// Not all servers support SIZE, carry on without validating the size or resuming.
+		logger.Log.Debugf("Unable to query the size of (%s), will not resume: %s", srcUrl.Redacted(), err)
+		expectedSize = -1
+	}
+
+	offset := int64(0)
+	if transfer.options.Resume && expectedSize > 0 {
+		offset = partialFileSize(dst)
+		if offset >= expectedSize {
+			offset = 0
+		}
+	}
+
+	response, err := conn.RetrFrom(srcUrl.Path, uint64(offset))
+	if err != nil {
+		if isFtpFileUnavailable(err) {
+			return false, fmt.Errorf("%w:\n%w", ErrDownloadFileInvalidResponse404, err)
+		}
+		return offset > 0, fmt.Errorf("%w:\nfailed to retrieve (%s):\n%w", ErrDownloadFileOther, srcUrl.Redacted(), err)
+	}
+	defer response.Close()
+
+	return writeToFile(dst, response, offset, expectedSize, transfer)
+}
+
+// isFtpFileUnavailable returns true if `err` is the server reporting that the requested file does not exist.
+func isFtpFileUnavailable(err error) bool {
+	var protocolErr *textproto.Error
+	return errors.As(err, &protocolErr) && protocolErr.Code == ftp.StatusFileUnavailable
+}
+
+// ftpConnTracker dials network connections and remembers them so they can all be closed at once.
+type ftpConnTracker struct {
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func (t *ftpConnTracker) dial(ctx context.Context, network, address string) (conn net.Conn, err error) {
+	dialer := net.Dialer{Timeout: ftp.DefaultDialTimeout}
+	conn, err = dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.conns = append(t.conns, conn)
+	return
+}
+
+func (t *ftpConnTracker) closeAll() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, conn := range t.conns {
+		conn.Close()
+	}
+}
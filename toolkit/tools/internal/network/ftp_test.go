@@ -0,0 +1,175 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package network
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFtpServer is a minimal FTP server which serves files from memory. Only the commands used by downloadFtpToFile
+// are implemented.
+type fakeFtpServer struct {
+	listener net.Listener
+	files    map[string]string
+
+	mutex       sync.Mutex
+	restOffsets []int64
+}
+
+func newFakeFtpServer(t *testing.T, files map[string]string) *fakeFtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeFtpServer{
+		listener: listener,
+		files:    files,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeFtpServer) url(path string) string {
+	return fmt.Sprintf("ftp://%s%s", s.listener.Addr().String(), path)
+}
+
+func (s *fakeFtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var (
+		dataListener net.Listener
+		offset       int64
+	)
+	defer func() {
+		if dataListener != nil {
+			dataListener.Close()
+		}
+	}()
+
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 Ready")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+		switch command {
+		case "USER":
+			reply("331 Password required")
+		case "PASS":
+			reply("230 Logged in")
+		case "TYPE":
+			reply("200 Type set")
+		case "SIZE":
+			content, ok := s.files[arg]
+			if !ok {
+				reply("550 No such file")
+				continue
+			}
+			reply("213 %d", len(content))
+		case "EPSV":
+			dataListener, err = net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				reply("425 Can't open data connection")
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", dataListener.Addr().(*net.TCPAddr).Port)
+		case "REST":
+			offset, _ = strconv.ParseInt(arg, 10, 64)
+			s.mutex.Lock()
+			s.restOffsets = append(s.restOffsets, offset)
+			s.mutex.Unlock()
+			reply("350 Restarting")
+		case "RETR":
+			content, ok := s.files[arg]
+			if !ok || dataListener == nil {
+				reply("550 No such file")
+				continue
+			}
+			reply("150 Opening data connection")
+			dataConn, err := dataListener.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(dataConn, content[offset:])
+			dataConn.Close()
+			dataListener.Close()
+			dataListener, offset = nil, 0
+			reply("226 Transfer complete")
+		case "QUIT":
+			reply("221 Goodbye")
+			return
+		default:
+			reply("502 Not implemented")
+		}
+	}
+}
+
+func TestDownloadFileFtp(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	server := newFakeFtpServer(t, map[string]string{"/dir/file": content})
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := DownloadFile(server.url("/dir/file"), dstFile, nil, nil)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileFtpResume(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	server := newFakeFtpServer(t, map[string]string{"/file": content})
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(dstFile, []byte(content[:10]), 0o644)
+	assert.NoError(t, err)
+
+	err = DownloadFileWithOptions(context.Background(), server.url("/file"), dstFile, nil, nil, DownloadOptions{Resume: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{10}, server.restOffsets)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileWithRetryFtpNotFound(t *testing.T) {
+	server := newFakeFtpServer(t, map[string]string{})
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	wasCancelled, err := DownloadFileWithRetry(context.Background(), server.url("/missing"), dstFile, nil, nil, 0)
+	assert.ErrorIs(t, err, ErrDownloadFileInvalidResponse404)
+	assert.False(t, wasCancelled)
+	assert.NoFileExists(t, dstFile)
+}
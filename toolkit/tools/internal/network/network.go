@@ -10,8 +10,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,11 +23,24 @@ import (
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/retry"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"golang.org/x/time/rate"
 )
 
 const (
 	// Default upper bound on a single network operation, across all retries.
 	DefaultTimeout = time.Minute * 10
+	// Default duration a download may go without receiving any data before it is considered stalled.
+	DefaultStallTimeout = time.Minute
+	// Default minimum duration between two calls to a download's progress callback.
+	DefaultProgressInterval = time.Second
+)
+
+// URL schemes supported by DownloadFile.
+const (
+	httpScheme  = "http"
+	httpsScheme = "https"
+	ftpScheme   = "ftp"
+	fileScheme  = "file"
 )
 
 // ErrDownloadFileInvalidResponse404 is returned when the download response is 404.
@@ -35,6 +52,21 @@ var ErrDownloadFileInvalidTimeout = errors.New("invalid timeout")
 // ErrDownloadFileOther is returned when the download error is anything other than 404.
 var ErrDownloadFileOther = errors.New("download error")
 
+// ErrDownloadFileSizeMismatch is returned when the downloaded file does not have the size reported by the server.
+var ErrDownloadFileSizeMismatch = fmt.Errorf("%w: size mismatch", ErrDownloadFileOther)
+
+// ErrDownloadFileChecksumMismatch is returned when the downloaded file does not match the expected checksum.
+var ErrDownloadFileChecksumMismatch = fmt.Errorf("%w: checksum mismatch", ErrDownloadFileOther)
+
+// ErrDownloadFileUnsupportedUrl is returned when the download URL is invalid or uses an unsupported scheme.
+var ErrDownloadFileUnsupportedUrl = errors.New("unsupported URL")
+
+// ErrDownloadFileInvalidProxy is returned when the proxy URL is invalid.
+var ErrDownloadFileInvalidProxy = errors.New("invalid proxy URL")
+
+// ErrDownloadFileStalled is returned when no data was received for longer than the stall timeout.
+var ErrDownloadFileStalled = fmt.Errorf("%w: download stalled", ErrDownloadFileOther)
+
 func buildResponseError(statusCode int) error {
 	if statusCode == http.StatusNotFound {
 		return ErrDownloadFileInvalidResponse404
@@ -43,7 +75,8 @@ func buildResponseError(statusCode int) error {
 	}
 }
 
-// JoinURL concatenates baseURL with extraPaths
+// JoinURL concatenates baseURL with extraPaths, using exactly one separator at each join boundary. Slashes inside
+// baseURL (such as the ones following the scheme) and a trailing slash on the last path are left untouched.
 func JoinURL(baseURL string, extraPaths ...string) string {
 	const urlPathSeparator = "/"
 
@@ -51,8 +84,58 @@ func JoinURL(baseURL string, extraPaths ...string) string {
 		return baseURL
 	}
 
-	appendToBase := strings.Join(extraPaths, urlPathSeparator)
-	return fmt.Sprintf("%s%s%s", baseURL, urlPathSeparator, appendToBase)
+	parts := []string{strings.TrimRight(baseURL, urlPathSeparator)}
+	for i, extraPath := range extraPaths {
+		extraPath = strings.TrimLeft(extraPath, urlPathSeparator)
+		if i < len(extraPaths)-1 {
+			extraPath = strings.TrimRight(extraPath, urlPathSeparator)
+		}
+
+		if extraPath != "" {
+			parts = append(parts, extraPath)
+		}
+	}
+
+	return strings.Join(parts, urlPathSeparator)
+}
+
+// ProgressFunc is called periodically while a file is being downloaded. bytesDownloaded includes any data resumed from
+// a partial file, totalBytes is the size of the whole file or -1 if the server did not report it.
+type ProgressFunc func(bytesDownloaded, totalBytes int64)
+
+// DownloadOptions holds optional settings that change how a file is downloaded. The zero value gives the default
+// behavior of DownloadFile.
+type DownloadOptions struct {
+	// Resume continues a partial download already present at the destination instead of starting over, as long as
+	// the server supports byte ranges. The partial file is kept on failure so a later attempt can pick it up again.
+	Resume bool
+	// ExpectedSha256 is the hex encoded SHA-256 digest the downloaded file must match. Leave empty to skip the check.
+	ExpectedSha256 string
+	// StallTimeout aborts the download if no data is received for this long. Use 0 to wait indefinitely.
+	StallTimeout time.Duration
+	// Progress, if set, is called periodically while data is received, and once more when an attempt finishes.
+	Progress ProgressFunc
+	// ProgressInterval is the minimum duration between two calls to Progress. Use 0 for DefaultProgressInterval.
+	ProgressInterval time.Duration
+	// ProxyUrl is the proxy to use for http(s):// downloads, overriding the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables. Leave empty to use the environment.
+	ProxyUrl string
+	// MaxBytesPerSecond caps the download bandwidth of a single call. All retries and mirrors of that call share the
+	// budget, concurrent calls are throttled separately. Use 0 for no limit.
+	MaxBytesPerSecond int64
+
+	// limiter enforces MaxBytesPerSecond, it is created once per call by withRateLimiter.
+	limiter *rate.Limiter
+}
+
+// withRateLimiter returns a copy of o with a limiter enforcing MaxBytesPerSecond, reusing the limiter of an outer call.
+func (o DownloadOptions) withRateLimiter() DownloadOptions {
+	if o.MaxBytesPerSecond > 0 && o.limiter == nil {
+		// Allow bursts of up to one second worth of data.
+		burst := int(min(o.MaxBytesPerSecond, math.MaxInt32))
+		o.limiter = rate.NewLimiter(rate.Limit(o.MaxBytesPerSecond), burst)
+	}
+	return o
 }
 
 // DownloadFile downloads a file from a URL to a local file. It will retry the download if it fails. If the externalCancel
@@ -68,6 +151,14 @@ func JoinURL(baseURL string, extraPaths ...string) string {
 // returns: wasCancelled: true if the download was cancelled via the external cancel channel, false otherwise.
 // returns: err: An error if the download failed (including being cancelled), nil otherwise.
 func DownloadFileWithRetry(ctx context.Context, srcUrl, dstFile string, caCerts *x509.CertPool, tlsCerts []tls.Certificate, timeout time.Duration) (wasCancelled bool, err error) {
+	return DownloadFileWithRetryAndOptions(ctx, srcUrl, dstFile, caCerts, tlsCerts, timeout, DownloadOptions{})
+}
+
+// DownloadFileWithRetryAndOptions behaves like DownloadFileWithRetry, but accepts additional download options. Retries
+// always resume from the data received by the previous attempt when the server supports it. Setting options.Resume
+// additionally allows the first attempt to resume a partial file left behind by an earlier, interrupted run. The
+// timeout also bounds any in-flight attempt, and a stalled attempt (see options.StallTimeout) is retried.
+func DownloadFileWithRetryAndOptions(ctx context.Context, srcUrl, dstFile string, caCerts *x509.CertPool, tlsCerts []tls.Certificate, timeout time.Duration, options DownloadOptions) (wasCancelled bool, err error) {
 	var (
 		retryCtx   context.Context
 		cancelFunc context.CancelFunc
@@ -84,10 +175,29 @@ func DownloadFileWithRetry(ctx context.Context, srcUrl, dstFile string, caCerts
 	}
 	defer cancelFunc()
 
+	// An unsupported URL will never succeed, don't bother retrying.
+	_, err = parseDownloadUrl(srcUrl)
+	if err == nil {
+		_, err = parseProxyUrl(options.ProxyUrl)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to download (%s) to (%s):\n%w", srcUrl, dstFile, err)
+	}
+
+	if !options.Resume {
+		err = file.RemoveFileIfExists(dstFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to remove stale download (%s):\n%w", dstFile, err)
+		}
+	}
+	// Keep any partial data between attempts so the next attempt can resume it, it will be cleaned up if we give up.
+	attemptOptions := options.withRateLimiter()
+	attemptOptions.Resume = true
+
 	retryNum := 1
 	errorWas404 := false
 	wasCancelled, err = retry.RunWithDefaultDownloadBackoff(retryCtx, func() error {
-		netErr := DownloadFile(srcUrl, dstFile, caCerts, tlsCerts)
+		netErr := DownloadFileWithOptions(retryCtx, srcUrl, dstFile, caCerts, tlsCerts, attemptOptions)
 		if netErr != nil {
 			// Check if the error is a 404, we should print a warning in that case so the user
 			// sees it even if we are running with --no-verbose. 404's are unlikely to fix themselves on retry, give up.
@@ -110,30 +220,185 @@ func DownloadFileWithRetry(ctx context.Context, srcUrl, dstFile string, caCerts
 	}
 
 	if err != nil {
+		cleanupErr := file.RemoveFileIfExists(dstFile)
+		if cleanupErr != nil {
+			logger.Log.Errorf("Failed to remove failed network download file '%s': %s", dstFile, cleanupErr)
+		}
 		err = fmt.Errorf("failed to download (%s) to (%s):\n%w", srcUrl, dstFile, err)
 	}
 	return
 }
 
-// DownloadFile downloads `url` into `dst`. `caCerts` may be nil. If there is an error `dst` will be removed.
-func DownloadFile(url, dst string, caCerts *x509.CertPool, tlsCerts []tls.Certificate) (err error) {
-	logger.Log.Debugf("Downloading (%s) -> (%s)", url, dst)
+// DownloadFileFromMirrors downloads the same file from the first of `srcUrls` that succeeds. Each mirror is tried in
+// order with DownloadFileWithRetryAndOptions, so the retry policy and timeout apply to every mirror separately. Only
+// cancelling `ctx` stops the search early.
+// returns: wasCancelled: true if `ctx` was cancelled before a mirror succeeded, false otherwise.
+// returns: err: An error containing every mirror's failure if none of them succeeded, nil otherwise.
+func DownloadFileFromMirrors(ctx context.Context, srcUrls []string, dstFile string, caCerts *x509.CertPool, tlsCerts []tls.Certificate, timeout time.Duration, options DownloadOptions) (wasCancelled bool, err error) {
+	if len(srcUrls) == 0 {
+		return false, fmt.Errorf("failed to download (%s):\nno URLs provided", dstFile)
+	}
 
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return fmt.Errorf("%w:\nfailed to create file:\n%w", ErrDownloadFileOther, err)
+	options = options.withRateLimiter()
+	mirrorErrs := []error{}
+	for i, srcUrl := range srcUrls {
+		wasCancelled, err = DownloadFileWithRetryAndOptions(ctx, srcUrl, dstFile, caCerts, tlsCerts, timeout, options)
+		if err == nil {
+			return
+		}
+		mirrorErrs = append(mirrorErrs, err)
+
+		if ctx.Err() != nil {
+			wasCancelled = true
+			break
+		}
+
+		if i < len(srcUrls)-1 {
+			logger.Log.Warnf("Failed to download from mirror (%s), trying the next one", srcUrl)
+		}
+		// Whatever the failed mirror left behind is of no use to the next one.
+		options.Resume = false
 	}
+
+	return wasCancelled, fmt.Errorf("failed to download (%s) from any of (%d) mirrors:\n%w", dstFile, len(srcUrls), errors.Join(mirrorErrs...))
+}
+
+// DownloadFile downloads `srcUrl` into `dst`. `caCerts` may be nil. If there is an error `dst` will be removed.
+// http(s)://, ftp:// and file:// URLs are supported.
+func DownloadFile(srcUrl, dst string, caCerts *x509.CertPool, tlsCerts []tls.Certificate) (err error) {
+	return DownloadFileWithOptions(context.Background(), srcUrl, dst, caCerts, tlsCerts, DownloadOptions{})
+}
+
+// DownloadFileWithOptions downloads `srcUrl` into `dst` using the provided options. `caCerts` may be nil. If there is
+// an error `dst` will be removed, unless options.Resume is set and the partial data is still usable. Cancelling `ctx`
+// aborts the download. http(s)://, ftp:// and file:// URLs are supported.
+func DownloadFileWithOptions(ctx context.Context, srcUrl, dst string, caCerts *x509.CertPool, tlsCerts []tls.Certificate, options DownloadOptions) (err error) {
+	logger.Log.Debugf("Downloading (%s) -> (%s)", srcUrl, dst)
+
+	keepPartialFile := false
 	defer func() {
 		// If there was an error, ensure that the file is removed
-		if err != nil {
+		if err != nil && !keepPartialFile {
 			cleanupErr := file.RemoveFileIfExists(dst)
 			if cleanupErr != nil {
-				logger.Log.Errorf("Failed to remove failed network download file '%s': %s", dst, err)
+				logger.Log.Errorf("Failed to remove failed network download file '%s': %s", dst, cleanupErr)
 			}
 		}
-		dstFile.Close()
 	}()
 
+	if ctx == nil {
+		return fmt.Errorf("context is nil")
+	}
+
+	parsedUrl, err := parseDownloadUrl(srcUrl)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var watchdog *stallWatchdog
+	if options.StallTimeout > 0 {
+		watchdog = newStallWatchdog(options.StallTimeout, func() {
+			cancel(ErrDownloadFileStalled)
+		})
+		defer watchdog.stop()
+	}
+
+	var limiter *rate.Limiter
+	if options.MaxBytesPerSecond > 0 && parsedUrl.Scheme != fileScheme {
+		limiter = options.withRateLimiter().limiter
+	}
+	transfer := transferOptions{
+		ctx:      ctx,
+		watchdog: watchdog,
+		limiter:  limiter,
+		options:  options,
+	}
+
+	switch parsedUrl.Scheme {
+	case fileScheme:
+		keepPartialFile, err = copyLocalFile(parsedUrl.Path, dst, transfer)
+	case ftpScheme:
+		keepPartialFile, err = downloadFtpToFile(parsedUrl, dst, transfer)
+	default:
+		keepPartialFile, err = downloadHttpToFile(srcUrl, dst, caCerts, tlsCerts, transfer)
+	}
+	if err != nil {
+		keepPartialFile = keepPartialFile && options.Resume
+		if errors.Is(context.Cause(ctx), ErrDownloadFileStalled) {
+			err = fmt.Errorf("%w (no data for %s):\n%w", ErrDownloadFileStalled, options.StallTimeout, err)
+		}
+		return
+	}
+
+	if options.ExpectedSha256 != "" {
+		// A complete file with the wrong contents can't be fixed by resuming, always start over.
+		keepPartialFile = false
+		err = verifySha256(dst, options.ExpectedSha256)
+	}
+
+	return
+}
+
+// transferOptions holds the per-download state shared by all URL schemes.
+type transferOptions struct {
+	// ctx cancels the transfer.
+	ctx context.Context
+	// watchdog, if set, is fed every time data is received.
+	watchdog *stallWatchdog
+	// limiter, if set, throttles the rate at which data is received.
+	limiter *rate.Limiter
+	// options are the caller's download options.
+	options DownloadOptions
+}
+
+// parseDownloadUrl parses `srcUrl` and checks that its scheme is supported by DownloadFile.
+func parseDownloadUrl(srcUrl string) (parsedUrl *url.URL, err error) {
+	parsedUrl, err = url.Parse(srcUrl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid URL (%s):\n%w", ErrDownloadFileUnsupportedUrl, srcUrl, err)
+	}
+
+	switch parsedUrl.Scheme {
+	case httpScheme, httpsScheme, ftpScheme:
+	case fileScheme:
+		if parsedUrl.Host != "" && parsedUrl.Host != "localhost" {
+			return nil, fmt.Errorf("%w: file URL (%s) must refer to a local path", ErrDownloadFileUnsupportedUrl, srcUrl)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme (%s) in URL (%s)", ErrDownloadFileUnsupportedUrl, parsedUrl.Scheme, srcUrl)
+	}
+
+	return parsedUrl, nil
+}
+
+// parseProxyUrl parses `proxyUrl`, returning nil if it is empty.
+func parseProxyUrl(proxyUrl string) (parsedUrl *url.URL, err error) {
+	if proxyUrl == "" {
+		return nil, nil
+	}
+
+	parsedUrl, err = url.Parse(proxyUrl)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s):\n%w", ErrDownloadFileInvalidProxy, proxyUrl, err)
+	}
+	if parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+		return nil, fmt.Errorf("%w (%s): must be of the form 'scheme://host[:port]'", ErrDownloadFileInvalidProxy, proxyUrl)
+	}
+
+	return parsedUrl, nil
+}
+
+// newHttpClient creates a client using the given certificates. Requests go through `proxyUrl` if it is set, otherwise
+// the proxy configured in the environment is used.
+func newHttpClient(caCerts *x509.CertPool, tlsCerts []tls.Certificate, proxyUrl string) (client *http.Client, err error) {
+	parsedProxyUrl, err := parseProxyUrl(proxyUrl)
+	if err != nil {
+		return nil, err
+	}
+
 	tlsConfig := &tls.Config{
 		RootCAs:      caCerts,
 		Certificates: tlsCerts,
@@ -143,28 +408,341 @@ func DownloadFile(url, dst string, caCerts *x509.CertPool, tlsCerts []tls.Certif
 	// Default is 10 seconds, we increase to 30 seconds to mitigate TLS handshake timeout errors
 	// we're seeing from some upstream RPM package sources
 	transport.TLSHandshakeTimeout = 30 * time.Second
-	client := &http.Client{
+	// Don't rely on the default transport having been set up with a proxy, always make it explicit.
+	if parsedProxyUrl != nil {
+		transport.Proxy = http.ProxyURL(parsedProxyUrl)
+	} else {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+
+	return &http.Client{
 		Transport: transport,
+	}, nil
+}
+
+// partialFileSize returns the size of an existing partial download at `dst`, or 0 if there is none.
+func partialFileSize(dst string) int64 {
+	info, err := os.Stat(dst)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+// findHttpResumeOffset returns the number of bytes of `dst` which can be skipped when downloading `srcUrl`. It
+// returns 0 if there is no partial file, or if the server does not advertise support for byte ranges.
+func findHttpResumeOffset(ctx context.Context, client *http.Client, srcUrl, dst string) (offset int64) {
+	partialSize := partialFileSize(dst)
+	if partialSize == 0 {
+		return 0
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, srcUrl, nil)
+	if err != nil {
+		return 0
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		logger.Log.Debugf("Unable to query (%s) for range support, will not resume: %s", srcUrl, err)
+		return 0
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK || response.Header.Get("Accept-Ranges") != "bytes" {
+		logger.Log.Debugf("Server for (%s) does not support byte ranges, will not resume", srcUrl)
+		return 0
 	}
 
-	response, err := client.Get(url)
+	// A partial file at least as large as the whole download can't be a prefix of it, start over.
+	if response.ContentLength >= 0 && partialSize >= response.ContentLength {
+		return 0
+	}
+
+	logger.Log.Debugf("Resuming download of (%s) from byte %d", srcUrl, partialSize)
+	return partialSize
+}
+
+// downloadHttpToFile requests `srcUrl` and writes the response into `dst`. If options.Resume is set and the server
+// supports it, only the data missing from a partial `dst` is requested. If the server ignores the range request
+// `dst` is overwritten from the start instead.
+// returns: partialUsable: true if `dst` holds a valid prefix of the download which may be resumed after an error.
+func downloadHttpToFile(srcUrl, dst string, caCerts *x509.CertPool, tlsCerts []tls.Certificate, transfer transferOptions) (partialUsable bool, err error) {
+	client, err := newHttpClient(caCerts, tlsCerts, transfer.options.ProxyUrl)
+	if err != nil {
+		return false, err
+	}
+
+	offset := int64(0)
+	if transfer.options.Resume {
+		offset = findHttpResumeOffset(transfer.ctx, client, srcUrl, dst)
+	}
+
+	request, err := http.NewRequestWithContext(transfer.ctx, http.MethodGet, srcUrl, nil)
+	if err != nil {
+		return false, fmt.Errorf("%w:\nfailed to create request:\n%w", ErrDownloadFileOther, err)
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := client.Do(request)
 	if err != nil {
-		return fmt.Errorf("%w:\nrequest failed:\n%w", ErrDownloadFileOther, err)
+		return offset > 0, fmt.Errorf("%w:\nrequest failed:\n%w", ErrDownloadFileOther, err)
 	}
 	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusOK {
-		return buildResponseError(response.StatusCode)
+	var expectedSize int64
+	switch response.StatusCode {
+	case http.StatusOK:
+		// Either a fresh download, or the server ignored the range request. Either way start from the beginning.
+		offset = 0
+		expectedSize = response.ContentLength
+	case http.StatusPartialContent:
+		var start int64
+		start, expectedSize, err = parseContentRange(response.Header.Get("Content-Range"))
+		if err != nil {
+			return false, fmt.Errorf("%w:\n%w", ErrDownloadFileOther, err)
+		}
+		if offset == 0 || start != offset {
+			return false, fmt.Errorf("%w: server returned range starting at byte %d, expected %d", ErrDownloadFileOther, start, offset)
+		}
+	default:
+		return offset > 0, buildResponseError(response.StatusCode)
+	}
+
+	return writeToFile(dst, response.Body, offset, expectedSize, transfer)
+}
+
+// copyLocalFile copies the local file `src` into `dst`. If options.Resume is set, only the data missing from a
+// partial `dst` is copied.
+// returns: partialUsable: true if `dst` holds a valid prefix of the download which may be resumed after an error.
+func copyLocalFile(src, dst string, transfer transferOptions) (partialUsable bool, err error) {
+	srcFile, err := os.Open(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Retrying won't make a missing local file appear, treat it the same as a 404.
+		return false, fmt.Errorf("%w:\n%w", ErrDownloadFileInvalidResponse404, err)
+	} else if err != nil {
+		return false, fmt.Errorf("%w:\nfailed to open file:\n%w", ErrDownloadFileOther, err)
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return false, fmt.Errorf("%w:\nfailed to stat file:\n%w", ErrDownloadFileOther, err)
+	}
+	if !info.Mode().IsRegular() {
+		return false, fmt.Errorf("%w: (%s) is not a regular file", ErrDownloadFileOther, src)
+	}
+
+	offset := int64(0)
+	if transfer.options.Resume {
+		offset = partialFileSize(dst)
+		if offset >= info.Size() {
+			offset = 0
+		}
+	}
+
+	if offset > 0 {
+		_, err = srcFile.Seek(offset, io.SeekStart)
+		if err != nil {
+			return false, fmt.Errorf("%w:\nfailed to seek file:\n%w", ErrDownloadFileOther, err)
+		}
+	}
+
+	return writeToFile(dst, srcFile, offset, info.Size(), transfer)
+}
+
+// writeToFile writes `body` into `dst`. If `offset` is non-zero the data is appended to the existing file, otherwise
+// `dst` is overwritten. The final size of `dst` is validated against `expectedSize`, unless it is negative. The
+// transfer's stall watchdog, rate limiter and progress reporting are applied to `body`.
+// returns: partialUsable: true if `dst` holds a valid prefix of the download which may be resumed after an error.
+func writeToFile(dst string, body io.Reader, offset, expectedSize int64, transfer transferOptions) (partialUsable bool, err error) {
+	flags := os.O_CREATE | os.O_WRONLY
+	if offset > 0 {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	dstFile, err := os.OpenFile(dst, flags, 0o666)
+	if err != nil {
+		return false, fmt.Errorf("%w:\nfailed to create file:\n%w", ErrDownloadFileOther, err)
+	}
+	defer dstFile.Close()
+
+	if transfer.watchdog != nil {
+		body = &watchdogReader{reader: body, watchdog: transfer.watchdog}
+	}
+	if transfer.limiter != nil {
+		body = &rateLimitedReader{ctx: transfer.ctx, reader: body, limiter: transfer.limiter}
+	}
+	if transfer.options.Progress != nil {
+		progress := newProgressReader(body, offset, expectedSize, transfer.options.Progress, transfer.options.ProgressInterval)
+		defer progress.report()
+		body = progress
+	}
+
+	_, err = io.Copy(dstFile, body)
+	if err != nil {
+		return true, fmt.Errorf("%w:\nfailed to write file:\n%w", ErrDownloadFileOther, err)
+	}
+
+	if expectedSize >= 0 {
+		info, statErr := dstFile.Stat()
+		if statErr != nil {
+			return false, fmt.Errorf("%w:\nfailed to stat file:\n%w", ErrDownloadFileOther, statErr)
+		}
+		if info.Size() != expectedSize {
+			return false, fmt.Errorf("%w: expected %d bytes, got %d", ErrDownloadFileSizeMismatch, expectedSize, info.Size())
+		}
+	}
+
+	return true, nil
+}
+
+// parseContentRange parses a 'Content-Range' header of the form 'bytes <start>-<end>/<total>'. The total size may be
+// '*' if unknown, in which case -1 is returned.
+func parseContentRange(contentRange string) (start, total int64, err error) {
+	var (
+		end      int64
+		totalStr string
+	)
+
+	_, err = fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &totalStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range (%s):\n%w", contentRange, err)
+	}
+
+	if totalStr == "*" {
+		return start, -1, nil
+	}
+
+	total, err = strconv.ParseInt(totalStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range (%s):\n%w", contentRange, err)
+	}
+
+	return start, total, nil
+}
+
+// stallWatchdog calls a function if it is not fed for longer than its timeout.
+type stallWatchdog struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newStallWatchdog(timeout time.Duration, onStall func()) *stallWatchdog {
+	return &stallWatchdog{
+		timer:   time.AfterFunc(timeout, onStall),
+		timeout: timeout,
+	}
+}
+
+// feed restarts the watchdog's countdown.
+func (w *stallWatchdog) feed() {
+	w.timer.Reset(w.timeout)
+}
+
+// stop disarms the watchdog.
+func (w *stallWatchdog) stop() {
+	w.timer.Stop()
+}
+
+// watchdogReader feeds a stallWatchdog every time data is read from the underlying reader.
+type watchdogReader struct {
+	reader   io.Reader
+	watchdog *stallWatchdog
+}
+
+func (r *watchdogReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	if n > 0 {
+		r.watchdog.feed()
 	}
+	return
+}
+
+// rateLimitedReader throttles reads from the underlying reader using a token bucket.
+type rateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (n int, err error) {
+	// Never ask the limiter for more than it can hand out at once.
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+
+	n, err = r.reader.Read(p)
+	if n > 0 {
+		waitErr := r.limiter.WaitN(r.ctx, n)
+		if waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return
+}
+
+// progressReader reports the number of bytes read so far to a ProgressFunc, at most once per interval.
+type progressReader struct {
+	reader     io.Reader
+	progress   ProgressFunc
+	interval   time.Duration
+	lastReport time.Time
+	bytesRead  int64
+	totalBytes int64
+}
 
-	_, err = io.Copy(dstFile, response.Body)
+func newProgressReader(reader io.Reader, bytesRead, totalBytes int64, progress ProgressFunc, interval time.Duration) *progressReader {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	return &progressReader{
+		reader:     reader,
+		progress:   progress,
+		interval:   interval,
+		lastReport: time.Now(),
+		bytesRead:  bytesRead,
+		totalBytes: totalBytes,
+	}
+}
 
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.bytesRead += int64(n)
+	if time.Since(r.lastReport) >= r.interval {
+		r.report()
+	}
 	return
 }
 
+// report unconditionally calls the progress function with the current state.
+func (r *progressReader) report() {
+	r.lastReport = time.Now()
+	r.progress(r.bytesRead, r.totalBytes)
+}
+
+// verifySha256 checks that the SHA-256 digest of `path` matches `expectedSha256`.
+func verifySha256(path, expectedSha256 string) (err error) {
+	actualSha256, err := file.GenerateSHA256(path)
+	if err != nil {
+		return fmt.Errorf("%w:\nfailed to hash file:\n%w", ErrDownloadFileOther, err)
+	}
+
+	if !strings.EqualFold(actualSha256, expectedSha256) {
+		return fmt.Errorf("%w: expected (%s), got (%s)", ErrDownloadFileChecksumMismatch, expectedSha256, actualSha256)
+	}
+
+	return nil
+}
+
 // CheckNetworkAccess checks whether the installer environment has network access
-// This function is only executed within the ISO installation environment for kickstart-like unattended installation
-func CheckNetworkAccess() (err error, hasNetworkAccess bool) {
+// This function is only executed within the ISO installation environment for kickstart-like unattended installation.
+// Cancelling ctx stops waiting for network access and returns an error.
+func CheckNetworkAccess(ctx context.Context) (err error, hasNetworkAccess bool) {
 	const (
 		retryAttempts = 10
 		retryDuration = time.Second
@@ -172,7 +750,7 @@ func CheckNetworkAccess() (err error, hasNetworkAccess bool) {
 		activeStatus  = "active"
 	)
 
-	err = retry.Run(func() error {
+	err = retry.RunWithContext(ctx, func() error {
 		err := shell.ExecuteLive(squashErrors, "systemctl", "restart", "systemd-networkd-wait-online")
 		if err != nil {
 			logger.Log.Errorf("Cannot start systemd-networkd-wait-online.service")
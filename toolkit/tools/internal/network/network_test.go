@@ -5,6 +5,7 @@ package network
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -13,10 +14,13 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/retry"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMain(m *testing.M) {
@@ -198,3 +202,578 @@ func TestDownloadWithRetryNilContext(t *testing.T) {
 		t.Errorf("DownloadFile() should have failed with nil context")
 	}
 }
+
+// newRangeServer returns a test server which serves content with byte range support. Every request's 'Range' header
+// is appended to rangeHeaders.
+func newRangeServer(t *testing.T, content string, rangeHeaders *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			*rangeHeaders = append(*rangeHeaders, r.Header.Get("Range"))
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadFileWithOptionsResume(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rangeHeaders := []string{}
+	server := newRangeServer(t, content, &rangeHeaders)
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(dstFile, []byte(content[:10]), 0o644)
+	assert.NoError(t, err)
+
+	err = DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, DownloadOptions{Resume: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bytes=10-"}, rangeHeaders)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileWithOptionsResumeWithoutRangeSupport(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rangeHeaders := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Advertise range support, but ignore the request and always send the whole file.
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Method == http.MethodGet {
+			rangeHeaders = append(rangeHeaders, r.Header.Get("Range"))
+			fmt.Fprint(w, content)
+		}
+	}))
+	defer server.Close()
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(dstFile, []byte("garbage"), 0o644)
+	assert.NoError(t, err)
+
+	err = DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, DownloadOptions{Resume: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bytes=7-"}, rangeHeaders)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileWithOptionsNoResumeOverwrites(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rangeHeaders := []string{}
+	server := newRangeServer(t, content, &rangeHeaders)
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(dstFile, []byte(content[:10]), 0o644)
+	assert.NoError(t, err)
+
+	err = DownloadFile(server.URL, dstFile, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, rangeHeaders)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileWithOptionsChecksum(t *testing.T) {
+	const content = "Valid file"
+	wrongSha256 := strings.Repeat("0", sha256.Size*2)
+	rangeHeaders := []string{}
+	server := newRangeServer(t, content, &rangeHeaders)
+	dstDir := t.TempDir()
+
+	actualSha256 := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	dstFile := filepath.Join(dstDir, "good")
+	err := DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, DownloadOptions{ExpectedSha256: actualSha256})
+	assert.NoError(t, err)
+	assert.FileExists(t, dstFile)
+
+	dstFile = filepath.Join(dstDir, "bad")
+	err = DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, DownloadOptions{Resume: true, ExpectedSha256: wrongSha256})
+	assert.ErrorIs(t, err, ErrDownloadFileChecksumMismatch)
+	assert.ErrorIs(t, err, ErrDownloadFileOther)
+	assert.NoFileExists(t, dstFile)
+}
+
+func TestDownloadFileWithRetryResumesAfterDroppedConnection(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rangeHeaders := []string{}
+	dropped := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			rangeHeaders = append(rangeHeaders, r.Header.Get("Range"))
+		}
+		if r.Method == http.MethodGet && !dropped {
+			// Send half of the file, then drop the connection.
+			dropped = true
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	_, err := DownloadFileWithRetry(context.Background(), server.URL, dstFile, nil, nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}, rangeHeaders)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileWithRetryRetriesChecksumMismatch(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		requests++
+		if requests == 1 {
+			// A bad mirror response of the right size but wrong contents.
+			fmt.Fprint(w, strings.ToUpper(content))
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	expectedSha256 := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	dstFile := filepath.Join(t.TempDir(), "file")
+	_, err := DownloadFileWithRetryAndOptions(context.Background(), server.URL, dstFile, nil, nil, 0, DownloadOptions{ExpectedSha256: expectedSha256})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentRange  string
+		expectedStart int64
+		expectedTotal int64
+		wantErr       bool
+	}{
+		{
+			name:          "known total",
+			contentRange:  "bytes 100-199/200",
+			expectedStart: 100,
+			expectedTotal: 200,
+		},
+		{
+			name:          "unknown total",
+			contentRange:  "bytes 100-199/*",
+			expectedStart: 100,
+			expectedTotal: -1,
+		},
+		{
+			name:         "missing unit",
+			contentRange: "100-199/200",
+			wantErr:      true,
+		},
+		{
+			name:         "bad total",
+			contentRange: "bytes 100-199/abc",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, total, err := parseContentRange(tt.contentRange)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStart, start)
+			assert.Equal(t, tt.expectedTotal, total)
+		})
+	}
+}
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		baseURL    string
+		extraPaths []string
+		expected   string
+	}{
+		{
+			name:     "no extra paths",
+			baseURL:  "https://host/",
+			expected: "https://host/",
+		},
+		{
+			name:       "plain join",
+			baseURL:    "https://host",
+			extraPaths: []string{"path"},
+			expected:   "https://host/path",
+		},
+		{
+			name:       "trailing slash base",
+			baseURL:    "https://host/",
+			extraPaths: []string{"path"},
+			expected:   "https://host/path",
+		},
+		{
+			name:       "leading slash segment",
+			baseURL:    "https://host",
+			extraPaths: []string{"/path"},
+			expected:   "https://host/path",
+		},
+		{
+			name:       "multiple segments",
+			baseURL:    "https://host/base/",
+			extraPaths: []string{"/a/", "b/", "//c"},
+			expected:   "https://host/base/a/b/c",
+		},
+		{
+			name:       "trailing slash on last segment is kept",
+			baseURL:    "https://host",
+			extraPaths: []string{"dir/"},
+			expected:   "https://host/dir/",
+		},
+		{
+			name:       "empty segment",
+			baseURL:    "https://host",
+			extraPaths: []string{"", "path"},
+			expected:   "https://host/path",
+		},
+		{
+			name:       "file scheme",
+			baseURL:    "file:///srv/repo/",
+			extraPaths: []string{"file.rpm"},
+			expected:   "file:///srv/repo/file.rpm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, JoinURL(tt.baseURL, tt.extraPaths...))
+		})
+	}
+}
+
+// newStallingServer returns a test server which sends the first half of content and then stops sending data until
+// the client gives up. Once stalledRequests requests have stalled, the content is served normally.
+func newStallingServer(t *testing.T, content string, stalledRequests int) *httptest.Server {
+	stalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || stalls >= stalledRequests {
+			http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+			return
+		}
+		stalls++
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadFileWithOptionsStallTimeout(t *testing.T) {
+	const (
+		content      = "0123456789abcdefghijklmnopqrstuvwxyz"
+		stallTimeout = 200 * time.Millisecond
+	)
+	server := newStallingServer(t, content, 1)
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	startTime := time.Now()
+	err := DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, DownloadOptions{StallTimeout: stallTimeout})
+	assert.ErrorIs(t, err, ErrDownloadFileStalled)
+	assert.ErrorIs(t, err, ErrDownloadFileOther)
+	assert.Less(t, time.Since(startTime), stallTimeout+(500*time.Millisecond))
+	assert.NoFileExists(t, dstFile)
+}
+
+func TestDownloadFileWithRetryRetriesStalledDownload(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	server := newStallingServer(t, content, 1)
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	options := DownloadOptions{StallTimeout: 200 * time.Millisecond}
+	_, err := DownloadFileWithRetryAndOptions(context.Background(), server.URL, dstFile, nil, nil, 0, options)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileWithRetryTimeoutAbortsInFlightDownload(t *testing.T) {
+	const (
+		content = "0123456789abcdefghijklmnopqrstuvwxyz"
+		timeout = 500 * time.Millisecond
+	)
+	server := newStallingServer(t, content, retry.DefaultDownloadRetryAttempts)
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	startTime := time.Now()
+	wasCancelled, err := DownloadFileWithRetry(context.Background(), server.URL, dstFile, nil, nil, timeout)
+	assert.Error(t, err)
+	assert.True(t, wasCancelled)
+	assert.Less(t, time.Since(startTime), timeout+(500*time.Millisecond))
+	assert.NoFileExists(t, dstFile)
+}
+
+func TestDownloadFileWithOptionsProgress(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rangeHeaders := []string{}
+	server := newRangeServer(t, content, &rangeHeaders)
+
+	type progressCall struct {
+		bytesDownloaded int64
+		totalBytes      int64
+	}
+	calls := []progressCall{}
+	options := DownloadOptions{
+		Resume: true,
+		Progress: func(bytesDownloaded, totalBytes int64) {
+			calls = append(calls, progressCall{bytesDownloaded, totalBytes})
+		},
+		// Long enough that only the final report is made.
+		ProgressInterval: time.Hour,
+	}
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(dstFile, []byte(content[:10]), 0o644)
+	assert.NoError(t, err)
+
+	err = DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, options)
+	assert.NoError(t, err)
+	assert.Equal(t, []progressCall{{int64(len(content)), int64(len(content))}}, calls)
+}
+
+func TestDownloadFileWithOptionsProgressUnknownSize(t *testing.T) {
+	const content = "Valid file"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before writing the body forces a chunked response without a Content-Length.
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	lastBytes, lastTotal := int64(0), int64(0)
+	options := DownloadOptions{
+		Progress: func(bytesDownloaded, totalBytes int64) {
+			lastBytes, lastTotal = bytesDownloaded, totalBytes
+		},
+	}
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, options)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), lastBytes)
+	assert.Equal(t, int64(-1), lastTotal)
+}
+
+func TestDownloadFileLocal(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	srcFile := filepath.Join(t.TempDir(), "src")
+	err := os.WriteFile(srcFile, []byte(content), 0o644)
+	assert.NoError(t, err)
+
+	dstFile := filepath.Join(t.TempDir(), "dst")
+	err = os.WriteFile(dstFile, []byte(content[:10]), 0o644)
+	assert.NoError(t, err)
+
+	_, err = DownloadFileWithRetryAndOptions(context.Background(), "file://"+srcFile, dstFile, nil, nil, 0, DownloadOptions{Resume: true})
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileLocalNotFound(t *testing.T) {
+	srcFile := filepath.Join(t.TempDir(), "missing")
+	dstFile := filepath.Join(t.TempDir(), "dst")
+
+	startTime := time.Now()
+	_, err := DownloadFileWithRetry(context.Background(), "file://"+srcFile, dstFile, nil, nil, 0)
+	assert.ErrorIs(t, err, ErrDownloadFileInvalidResponse404)
+	// Not retried.
+	assert.Less(t, time.Since(startTime), 500*time.Millisecond)
+	assert.NoFileExists(t, dstFile)
+}
+
+func TestDownloadFileUnsupportedUrl(t *testing.T) {
+	dstFile := filepath.Join(t.TempDir(), "dst")
+
+	for _, srcUrl := range []string{"gopher://host/file", "file://remotehost/file", "://bad"} {
+		startTime := time.Now()
+		_, err := DownloadFileWithRetry(context.Background(), srcUrl, dstFile, nil, nil, 0)
+		assert.ErrorIs(t, err, ErrDownloadFileUnsupportedUrl, srcUrl)
+		// Not retried.
+		assert.Less(t, time.Since(startTime), 500*time.Millisecond)
+		assert.NoFileExists(t, dstFile)
+	}
+}
+
+func TestDownloadFileWithOptionsProxy(t *testing.T) {
+	const (
+		content = "Proxied file"
+		// Never resolved, the proxy answers for it.
+		srcUrl = "http://packages.invalid/file"
+	)
+	proxiedUrls := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedUrls = append(proxiedUrls, r.URL.String())
+		fmt.Fprint(w, content)
+	}))
+	defer proxy.Close()
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	err := DownloadFileWithOptions(context.Background(), srcUrl, dstFile, nil, nil, DownloadOptions{ProxyUrl: proxy.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{srcUrl}, proxiedUrls)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestNewHttpClientProxy(t *testing.T) {
+	const proxyUrl = "http://proxy.invalid:3128"
+	request, err := http.NewRequest(http.MethodGet, "https://packages.invalid/file", nil)
+	assert.NoError(t, err)
+
+	client, err := newHttpClient(nil, nil, proxyUrl)
+	assert.NoError(t, err)
+	transport := client.Transport.(*http.Transport)
+	assert.NotNil(t, transport.Proxy)
+
+	usedProxy, err := transport.Proxy(request)
+	assert.NoError(t, err)
+	assert.Equal(t, proxyUrl, usedProxy.String())
+
+	// Without an explicit proxy the environment must be honored.
+	t.Setenv("HTTPS_PROXY", "http://envproxy.invalid:8080")
+	client, err = newHttpClient(nil, nil, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, client.Transport.(*http.Transport).Proxy)
+}
+
+func TestDownloadFileInvalidProxy(t *testing.T) {
+	dstFile := filepath.Join(t.TempDir(), "file")
+
+	for _, proxyUrl := range []string{"proxy.invalid:3128", "://bad"} {
+		startTime := time.Now()
+		_, err := DownloadFileWithRetryAndOptions(context.Background(), "http://packages.invalid/file", dstFile, nil, nil, 0, DownloadOptions{ProxyUrl: proxyUrl})
+		assert.ErrorIs(t, err, ErrDownloadFileInvalidProxy, proxyUrl)
+		// Not retried.
+		assert.Less(t, time.Since(startTime), 500*time.Millisecond)
+	}
+}
+
+func TestDownloadFileWithOptionsMaxBytesPerSecond(t *testing.T) {
+	const bytesPerSecond = 1000
+	// The first second worth of data is allowed as a burst, the rest should take about a second.
+	content := strings.Repeat("x", 2*bytesPerSecond)
+	rangeHeaders := []string{}
+	server := newRangeServer(t, content, &rangeHeaders)
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	startTime := time.Now()
+	err := DownloadFileWithOptions(context.Background(), server.URL, dstFile, nil, nil, DownloadOptions{MaxBytesPerSecond: bytesPerSecond})
+	elapsed := time.Since(startTime)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, elapsed, 900*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestRateLimiterIsScopedToOneCall(t *testing.T) {
+	options := DownloadOptions{MaxBytesPerSecond: 100}
+
+	callOptions := options.withRateLimiter()
+	if assert.NotNil(t, callOptions.limiter) {
+		// Retries and mirrors of the same call reuse its limiter.
+		assert.Same(t, callOptions.limiter, callOptions.withRateLimiter().limiter)
+		// Another call gets its own budget.
+		assert.NotSame(t, callOptions.limiter, options.withRateLimiter().limiter)
+	}
+
+	assert.Nil(t, DownloadOptions{}.withRateLimiter().limiter)
+}
+
+func TestDownloadFileFromMirrorsFailsOver(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	missingServer := httptest.NewServer(http.NotFoundHandler())
+	defer missingServer.Close()
+	goodServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content)
+	}))
+	defer goodServer.Close()
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	wasCancelled, err := DownloadFileFromMirrors(context.Background(), []string{missingServer.URL, goodServer.URL}, dstFile, nil, nil, 0, DownloadOptions{})
+	assert.NoError(t, err)
+	assert.False(t, wasCancelled)
+
+	data, err := os.ReadFile(dstFile)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileFromMirrorsAllFail(t *testing.T) {
+	missingServer := httptest.NewServer(http.NotFoundHandler())
+	defer missingServer.Close()
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	mirrors := []string{missingServer.URL + "/a", missingServer.URL + "/b"}
+	wasCancelled, err := DownloadFileFromMirrors(context.Background(), mirrors, dstFile, nil, nil, 0, DownloadOptions{})
+	assert.ErrorIs(t, err, ErrDownloadFileInvalidResponse404)
+	assert.False(t, wasCancelled)
+	for _, mirror := range mirrors {
+		assert.ErrorContains(t, err, mirror)
+	}
+	assert.NoFileExists(t, dstFile)
+}
+
+func TestDownloadFileFromMirrorsStopsWhenCancelled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dstFile := filepath.Join(t.TempDir(), "file")
+	wasCancelled, err := DownloadFileFromMirrors(ctx, []string{server.URL + "/a", server.URL + "/b"}, dstFile, nil, nil, 0, DownloadOptions{})
+	assert.Error(t, err)
+	assert.True(t, wasCancelled)
+	assert.Zero(t, requests)
+}
+
+func TestDownloadFileFromMirrorsRequiresUrls(t *testing.T) {
+	_, err := DownloadFileFromMirrors(context.Background(), nil, filepath.Join(t.TempDir(), "file"), nil, nil, 0, DownloadOptions{})
+	assert.Error(t, err)
+}
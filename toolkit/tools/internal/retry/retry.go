@@ -7,15 +7,31 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 )
 
+// Jitter selects how much randomness is added to a backoff delay, so that many callers failing at the same time
+// don't all retry in lockstep.
+type Jitter int
+
+const (
+	// NoJitter uses the computed delay as-is.
+	NoJitter Jitter = iota
+	// FullJitter picks a random delay between 0 and the computed delay.
+	FullJitter
+	// EqualJitter keeps half of the computed delay and picks the other half at random.
+	EqualJitter
+)
+
 const (
 	// With 8 attempts (7 retries) and a backoff factor of 2 seconds the total time spent retrying will be approximately:
 	// 0 + 1 + 2 + 4 + 8 + 16 + 32 + 64 = 127 seconds (2 min, 7 sec)
 	DefaultDownloadBackoffBase   = 2.0
 	DefaultDownloadRetryAttempts = 8
 	DefaultDownloadRetryDuration = time.Second
+	// Jitter keeps parallel downloads that fail together from retrying against the server at the same moment.
+	DefaultDownloadJitter = EqualJitter
 )
 
 var (
@@ -41,6 +57,23 @@ func calculateExpDelay(failCount int, sleep time.Duration, backoffExponentBase f
 	return time.Duration(expRetry * float64(sleep))
 }
 
+// applyJitter randomizes delay according to jitter. The result is always between 0 and delay.
+func applyJitter(delay time.Duration, jitter Jitter) time.Duration {
+	if delay <= 0 {
+		return delay
+	}
+
+	switch jitter {
+	case FullJitter:
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	case EqualJitter:
+		half := delay / 2
+		return delay - half + time.Duration(rand.Int63n(int64(half)+1))
+	default:
+		return delay
+	}
+}
+
 func calculateLinearDelay(failCount int, sleep time.Duration) time.Duration {
 	if failCount <= 0 {
 		return 0
@@ -99,6 +132,16 @@ func Run(function func() error, attempts int, sleep time.Duration) (err error) {
 	return
 }
 
+// RunWithContext runs function up to 'attempts' times, waiting i * sleep duration before each i-th attempt. If ctx is
+// cancelled the retry loop stops immediately, even in the middle of a sleep, and the returned error wraps ctx.Err().
+func RunWithContext(ctx context.Context, function func() error, attempts int, sleep time.Duration) (err error) {
+	wasCancelled, err := RunWithLinearBackoff(ctx, function, attempts, sleep)
+	if wasCancelled {
+		err = fmt.Errorf("%w:\n%w", ctx.Err(), err)
+	}
+	return
+}
+
 // RunWithLinearBackoff runs function up to 'attempts' times, waiting i * sleep duration before each i-th attempt. An
 // optional context can be provided to cancel the retry loop immediately.
 func RunWithLinearBackoff(ctx context.Context, function func() error, attempts int, sleep time.Duration) (wasCancelled bool, err error) {
@@ -107,18 +150,25 @@ func RunWithLinearBackoff(ctx context.Context, function func() error, attempts i
 	}, attempts)
 }
 
-// RunWithDefaultDownloadBackoff runs function up to 'DefaultDownloadRetryAttempts' times, waiting 'DefaultDownloadBackoffBase^(i-1)' seconds before
-// each i-th attempt. An optional context can be provided to cancel the retry loop immediately.
+// RunWithDefaultDownloadBackoff runs function up to 'DefaultDownloadRetryAttempts' times, waiting up to
+// 'DefaultDownloadBackoffBase^(i-1)' seconds (randomized with 'DefaultDownloadJitter') before each i-th attempt. An
+// optional context can be provided to cancel the retry loop immediately.
 //
 // The function is meant as a default for network download operations.
 func RunWithDefaultDownloadBackoff(ctx context.Context, function func() error) (wasCancelled bool, err error) {
-	return RunWithExpBackoff(ctx, function, DefaultDownloadRetryAttempts, DefaultDownloadRetryDuration, DefaultDownloadBackoffBase)
+	return RunWithExpBackoffAndJitter(ctx, function, DefaultDownloadRetryAttempts, DefaultDownloadRetryDuration, DefaultDownloadBackoffBase, DefaultDownloadJitter)
 }
 
 // RunWithExpBackoff runs function up to 'attempts' times, waiting 'backoffExponentBase^(i-1) * sleep' duration before
 // each i-th attempt. An optional context can be provided to cancel the retry loop immediately.
 func RunWithExpBackoff(ctx context.Context, function func() error, attempts int, sleep time.Duration, backoffExponentBase float64) (wasCancelled bool, err error) {
+	return RunWithExpBackoffAndJitter(ctx, function, attempts, sleep, backoffExponentBase, NoJitter)
+}
+
+// RunWithExpBackoffAndJitter behaves like RunWithExpBackoff, but randomizes each delay according to 'jitter'. The
+// delays never exceed those of RunWithExpBackoff.
+func RunWithExpBackoffAndJitter(ctx context.Context, function func() error, attempts int, sleep time.Duration, backoffExponentBase float64, jitter Jitter) (wasCancelled bool, err error) {
 	return runWithBackoffInternal(ctx, function, func(failCount int) time.Duration {
-		return calculateExpDelay(failCount, sleep, backoffExponentBase)
+		return applyJitter(calculateExpDelay(failCount, sleep, backoffExponentBase), jitter)
 	}, attempts)
 }
@@ -239,3 +239,100 @@ func TestFailsOnNilCtx(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.ErrorIs(t, err, ErrNilContext)
 }
+
+func TestApplyNoJitter(t *testing.T) {
+	assert.Equal(t, defaultTestTime, applyJitter(defaultTestTime, NoJitter))
+}
+
+func TestApplyJitterZeroDelay(t *testing.T) {
+	for _, jitter := range []Jitter{NoJitter, FullJitter, EqualJitter} {
+		assert.Equal(t, time.Duration(0), applyJitter(0, jitter))
+	}
+}
+
+func TestApplyFullJitterBounds(t *testing.T) {
+	const samples = 1000
+	for i := 0; i < samples; i++ {
+		delay := applyJitter(defaultTestTime, FullJitter)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, defaultTestTime)
+	}
+}
+
+func TestApplyEqualJitterBounds(t *testing.T) {
+	const samples = 1000
+	for i := 0; i < samples; i++ {
+		delay := applyJitter(defaultTestTime, EqualJitter)
+		assert.GreaterOrEqual(t, delay, defaultTestTime/2)
+		assert.LessOrEqual(t, delay, defaultTestTime)
+	}
+}
+
+func TestApplyJitterVaries(t *testing.T) {
+	const samples = 100
+	seen := map[time.Duration]bool{}
+	for i := 0; i < samples; i++ {
+		seen[applyJitter(defaultTestTime, FullJitter)] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+func TestTotalRunTimeWithFailuresEqualJitter(t *testing.T) {
+	attempts := 3
+	base := 2.0
+	startTime := time.Now()
+	cancelled, err := RunWithExpBackoffAndJitter(context.Background(), func() error {
+		return errTest
+	}, attempts, defaultTestTime, base, EqualJitter)
+	endTime := time.Now()
+	assert.ErrorIs(t, err, errTest)
+	assert.False(t, cancelled)
+	// Unjittered delays would be 0 seconds, <attempt>, .1 second, <attempt>, .2 seconds, <attempt>, equal jitter keeps
+	// at least half of each.
+	idealTime := time.Millisecond * 300
+	minDelay := idealTime / 2
+	maxDelay := idealTime + timingFudgeFactor
+	assert.GreaterOrEqual(t, endTime.Sub(startTime), minDelay)
+	assert.LessOrEqual(t, endTime.Sub(startTime), maxDelay)
+}
+
+func TestRunWithContextSucceeds(t *testing.T) {
+	attempts := 0
+	err := RunWithContext(context.Background(), func() error {
+		attempts++
+		if attempts < 2 {
+			return errTest
+		}
+		return nil
+	}, 3, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRunWithContextCancelledDuringSleep(t *testing.T) {
+	const longSleep = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	startTime := time.Now()
+	err := RunWithContext(ctx, func() error {
+		attempts++
+		// Cancel once the loop is about to sleep before the next attempt.
+		time.AfterFunc(defaultTestTime, cancel)
+		return errTest
+	}, 3, longSleep)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errTest)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(startTime), defaultTestTime+timingFudgeFactor)
+}
+
+func TestRunWithContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTestTime)
+	defer cancel()
+
+	err := RunWithContext(ctx, func() error {
+		return errTest
+	}, 3, time.Hour)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
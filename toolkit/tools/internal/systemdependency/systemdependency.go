@@ -25,3 +25,21 @@ func GzipTool() (gzipTool string, err error) {
 
 	return
 }
+
+// Bzip2Tool returns the bzip2 tool to use on the host
+func Bzip2Tool() (bzip2Tool string, err error) {
+	toolsToCheck := []string{"pbzip2", "bzip2"}
+
+	for _, tool := range toolsToCheck {
+		bzip2Tool, err = exec.LookPath(tool)
+		if err == nil {
+			break
+		}
+	}
+
+	if bzip2Tool == "" {
+		err = fmt.Errorf("failed to find a suitable bzip2 tool on the current system")
+	}
+
+	return
+}
@@ -0,0 +1,59 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+// Bzip2Type represents the bzip2 format
+const Bzip2Type = "bz2"
+
+// Bzip2 implements Converter interface to convert a RAW image into a bzip2 file
+type Bzip2 struct {
+}
+
+// Convert converts the image in the bzip2 format
+func (b *Bzip2) Convert(input, output string, isInputFile bool) (err error) {
+	if !isInputFile {
+		return fmt.Errorf("bz2 compression requires a file as an input")
+	}
+
+	tool, err := systemdependency.Bzip2Tool()
+	if err != nil {
+		return
+	}
+
+	srcFile, err := os.Open(input)
+	if err != nil {
+		return
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(output)
+	if err != nil {
+		return
+	}
+	defer dstFile.Close()
+
+	return compressWithTool(srcFile, dstFile, tool, "-z", "-c")
+}
+
+// Tools returns the external programs run by this converter.
+func (b *Bzip2) Tools() []string {
+	return []string{lookupToolName(systemdependency.Bzip2Tool, "bzip2")}
+}
+
+// Extension returns the filetype extension produced by this converter.
+func (b *Bzip2) Extension() string {
+	return Bzip2Type
+}
+
+// NewBzip2 returns a new bzip2 format encoder
+func NewBzip2() *Bzip2 {
+	return &Bzip2{}
+}
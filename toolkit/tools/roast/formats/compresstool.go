@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// compressionThreads returns threads, or the number of CPUs on the host if threads is not positive.
+func compressionThreads(threads int) int {
+	if threads <= 0 {
+		return runtime.NumCPU()
+	}
+	return threads
+}
+
+// lookupToolName returns the name of the tool found by lookup, or fallback if none is installed on the host.
+func lookupToolName(lookup func() (string, error), fallback string) string {
+	tool, err := lookup()
+	if err != nil {
+		return fallback
+	}
+	return filepath.Base(tool)
+}
+
+// compressWithTool runs the compression tool with args, feeding it src on stdin and writing its stdout to dst.
+func compressWithTool(src io.Reader, dst io.Writer, tool string, args ...string) (err error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(tool, args...)
+	cmd.Stdin = src
+	cmd.Stdout = dst
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to compress with (%s):\n%w\n%s", tool, err, stderr.String())
+	}
+
+	return
+}
@@ -8,3 +8,8 @@ type Converter interface {
 	Convert(input, output string, isInputFile bool) error
 	Extension() string
 }
+
+// ExternalToolUser is implemented by converters which run external programs rather than converting in-process.
+type ExternalToolUser interface {
+	Tools() []string
+}
@@ -4,7 +4,10 @@
 package formats
 
 import (
+	"archive/tar"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
 )
@@ -25,6 +28,39 @@ func (e *Diff) Convert(input, output string, isInputFile bool) (err error) {
 	return
 }
 
+// Verify reads the whole overlay diff, a tarball of the overlay's upper directory, and checks that it is intact.
+// Unlike rdiff, an overlay diff is layered over its base at boot rather than applied to it, so there is no
+// reconstructed image to compare against.
+func (e *Diff) Verify(delta string) (err error) {
+	deltaFile, err := os.Open(delta)
+	if err != nil {
+		return
+	}
+	defer deltaFile.Close()
+
+	entries := 0
+	tarReader := tar.NewReader(deltaFile)
+	for {
+		var header *tar.Header
+		header, err = tarReader.Next()
+		if err == io.EOF {
+			if entries == 0 {
+				return fmt.Errorf("overlay diff (%s) is empty", delta)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("overlay diff (%s) is not a valid tarball:\n%w", delta, err)
+		}
+
+		_, err = io.Copy(io.Discard, tarReader)
+		if err != nil {
+			return fmt.Errorf("failed to read (%s) from overlay diff (%s):\n%w", header.Name, delta, err)
+		}
+		entries++
+	}
+}
+
 // Extension returns the filetype extension produced by this converter.
 func (e *Diff) Extension() string {
 	return DiffType
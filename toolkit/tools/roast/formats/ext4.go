@@ -3,11 +3,7 @@
 
 package formats
 
-import (
-	"fmt"
-
-	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
-)
+import "fmt"
 
 // Ext4Type represents the ext4 file system format
 const Ext4Type = "ext4"
@@ -16,12 +12,12 @@ const Ext4Type = "ext4"
 type Ext4 struct {
 }
 
-// Convert simply makes a copy of the RAW image and renames the extension to ext4
+// Convert simply makes a sparse copy of the RAW image and renames the extension to ext4
 func (e *Ext4) Convert(input, output string, isInputFile bool) (err error) {
 	if !isInputFile {
 		return fmt.Errorf("ext4 conversion requires a RAW file as an input")
 	}
-	err = file.Copy(input, output)
+	err = copySparse(input, output)
 	return
 }
 
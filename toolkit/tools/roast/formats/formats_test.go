@@ -0,0 +1,627 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+// requireCommand skips the test if `name` isn't installed on the host.
+func requireCommand(t *testing.T, name string) {
+	exists, err := file.CommandExists(name)
+	if err != nil || !exists {
+		t.Skipf("Test requires (%s) to be installed", name)
+	}
+}
+
+// createRawFixture writes a small raw disk image with some non-zero data to a temporary directory.
+func createRawFixture(t *testing.T) (rawFile string) {
+	const fixtureSize = 1024 * 1024
+
+	data := make([]byte, fixtureSize)
+	for i := 0; i < len(data); i += 4096 {
+		copy(data[i:], "raw fixture data")
+	}
+
+	rawFile = filepath.Join(t.TempDir(), "disk.raw")
+	err := os.WriteFile(rawFile, data, 0o644)
+	assert.NoError(t, err)
+	return
+}
+
+func TestQcowConvert(t *testing.T) {
+	requireCommand(t, "qemu-img")
+
+	// Every qcow(2) file starts with this magic number.
+	qcowMagic := []byte{'Q', 'F', 'I', 0xfb}
+
+	converter := NewQcow()
+	assert.Equal(t, "qcow2", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(createRawFixture(t), output, true)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, qcowMagic, data[:len(qcowMagic)])
+}
+
+func TestQcowConvertRequiresFile(t *testing.T) {
+	err := NewQcow().Convert(t.TempDir(), filepath.Join(t.TempDir(), "disk.qcow2"), false)
+	assert.Error(t, err)
+}
+
+func TestZstdConvert(t *testing.T) {
+	input := createRawFixture(t)
+
+	converter := NewZstd()
+	assert.Equal(t, "zst", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	zstdReader, err := zstd.NewReader(compressedFile)
+	assert.NoError(t, err)
+	defer zstdReader.Close()
+
+	decompressed, err := io.ReadAll(zstdReader)
+	assert.NoError(t, err)
+
+	expected, err := os.ReadFile(input)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decompressed)
+}
+
+func TestZstdConvertRequiresFile(t *testing.T) {
+	err := NewZstd().Convert(t.TempDir(), filepath.Join(t.TempDir(), "disk.zst"), false)
+	assert.Error(t, err)
+}
+
+func TestTarZstdConvert(t *testing.T) {
+	requireCommand(t, "zstd")
+
+	input := createRawFixture(t)
+
+	converter := NewTarZstd()
+	assert.Equal(t, "tar.zst", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	zstdReader, err := zstd.NewReader(compressedFile)
+	assert.NoError(t, err)
+	defer zstdReader.Close()
+
+	tarReader := tar.NewReader(zstdReader)
+	header, err := tarReader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Base(input), filepath.Base(header.Name))
+}
+
+func TestTarZstdConvertKeepsXattrs(t *testing.T) {
+	requireCommand(t, "zstd")
+
+	input := createXattrFixture(t)
+	output := filepath.Join(t.TempDir(), "rootfs.tar.zst")
+	err := NewTarZstd().Convert(input, output, false)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	zstdReader, err := zstd.NewReader(compressedFile)
+	assert.NoError(t, err)
+	defer zstdReader.Close()
+
+	assertTarKeepsXattrs(t, zstdReader)
+}
+
+const (
+	fixtureXattrName  = "user.roast-test"
+	fixtureXattrValue = "label"
+)
+
+// createXattrFixture writes a directory containing a single file with an extended attribute, skipping the test if the
+// temporary directory does not support user extended attributes.
+func createXattrFixture(t *testing.T) (dir string) {
+	dir = t.TempDir()
+	labeledFile := filepath.Join(dir, "labeled")
+	err := os.WriteFile(labeledFile, []byte("labeled file"), 0o644)
+	assert.NoError(t, err)
+
+	err = unix.Setxattr(labeledFile, fixtureXattrName, []byte(fixtureXattrValue), 0)
+	if err != nil {
+		t.Skipf("Test requires user extended attribute support: %s", err)
+	}
+	return
+}
+
+// assertTarKeepsXattrs checks that the file from createXattrFixture kept its extended attribute in the tarball.
+func assertTarKeepsXattrs(t *testing.T, reader io.Reader) {
+	const paxXattrPrefix = "SCHILY.xattr."
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		if filepath.Base(header.Name) == "labeled" {
+			assert.Equal(t, fixtureXattrValue, header.PAXRecords[paxXattrPrefix+fixtureXattrName])
+			return
+		}
+	}
+
+	assert.Fail(t, "labeled file not found in the tarball")
+}
+
+// assertDecompressesTo checks that reading `reader` to the end yields the contents of `expectedFile`.
+func assertDecompressesTo(t *testing.T, reader io.Reader, expectedFile string) {
+	decompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+
+	expected, err := os.ReadFile(expectedFile)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decompressed)
+}
+
+func TestGzipConvertMultithreaded(t *testing.T) {
+	const threads = 4
+	input := createRawFixture(t)
+
+	converter := NewGzip(threads)
+	assert.Equal(t, "gz", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	gzipReader, err := gzip.NewReader(compressedFile)
+	assert.NoError(t, err)
+	defer gzipReader.Close()
+
+	assertDecompressesTo(t, gzipReader, input)
+}
+
+func TestGzipConvertDefaultThreads(t *testing.T) {
+	input := createRawFixture(t)
+
+	converter := NewGzip(0)
+	assert.Equal(t, runtime.NumCPU(), converter.threads)
+
+	output := filepath.Join(t.TempDir(), "disk.gz")
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	gzipReader, err := gzip.NewReader(compressedFile)
+	assert.NoError(t, err)
+	defer gzipReader.Close()
+
+	assertDecompressesTo(t, gzipReader, input)
+}
+
+func TestXzDefaultThreads(t *testing.T) {
+	assert.Equal(t, runtime.NumCPU(), NewXz(0).threads)
+	assert.Equal(t, runtime.NumCPU(), NewXz(-1).threads)
+	assert.Equal(t, 3, NewXz(3).threads)
+}
+
+func TestXzConvertMultithreaded(t *testing.T) {
+	const threads = 4
+	requireCommand(t, "xz")
+
+	input := createRawFixture(t)
+
+	converter := NewXz(threads)
+	assert.Equal(t, "xz", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	xzReader, err := xz.NewReader(compressedFile)
+	assert.NoError(t, err)
+
+	assertDecompressesTo(t, xzReader, input)
+}
+
+func TestXzConvertWithoutTool(t *testing.T) {
+	input := createRawFixture(t)
+
+	// Hide the xz tool so the single threaded fallback is used.
+	t.Setenv("PATH", t.TempDir())
+
+	output := filepath.Join(t.TempDir(), "disk.xz")
+	err := NewXz(1).Convert(input, output, true)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	xzReader, err := xz.NewReader(compressedFile)
+	assert.NoError(t, err)
+
+	assertDecompressesTo(t, xzReader, input)
+}
+
+func TestVmdkConvert(t *testing.T) {
+	requireCommand(t, "qemu-img")
+
+	// Both supported subformats use sparse extents, which start with this magic number.
+	vmdkSparseMagic := []byte("KDMV")
+
+	for _, subformat := range VmdkSubformats() {
+		t.Run(subformat, func(t *testing.T) {
+			converter := NewVmdk(subformat)
+			assert.Equal(t, "vmdk", converter.Extension())
+
+			output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+			err := converter.Convert(createRawFixture(t), output, true)
+			assert.NoError(t, err)
+
+			data, err := os.ReadFile(output)
+			assert.NoError(t, err)
+			assert.Equal(t, vmdkSparseMagic, data[:len(vmdkSparseMagic)])
+		})
+	}
+}
+
+func TestVmdkConvertUnsupportedSubformat(t *testing.T) {
+	err := NewVmdk("monolithicFlat").Convert(createRawFixture(t), filepath.Join(t.TempDir(), "disk.vmdk"), true)
+	assert.ErrorContains(t, err, "unsupported vmdk subformat")
+}
+
+func TestVmdkConvertRequiresFile(t *testing.T) {
+	err := NewVmdk(VmdkDefaultSubformat).Convert(t.TempDir(), filepath.Join(t.TempDir(), "disk.vmdk"), false)
+	assert.Error(t, err)
+}
+
+// createSparseFixture writes a raw image with data at both ends and a large run of zeros in between.
+func createSparseFixture(t *testing.T) (rawFile string) {
+	const (
+		zeroRegionSize = 8 * 1024 * 1024
+		dataSize       = 4096 + 100
+	)
+
+	data := bytes.Repeat([]byte{0xAA}, dataSize)
+	image := append(append(append([]byte{}, data...), make([]byte, zeroRegionSize)...), data...)
+
+	rawFile = filepath.Join(t.TempDir(), "sparse.raw")
+	err := os.WriteFile(rawFile, image, 0o640)
+	assert.NoError(t, err)
+	return
+}
+
+func TestSparseCopyConverters(t *testing.T) {
+	for _, converter := range []Converter{NewRaw(), NewExt4()} {
+		t.Run(converter.Extension(), func(t *testing.T) {
+			input := createSparseFixture(t)
+			output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+
+			err := converter.Convert(input, output, true)
+			assert.NoError(t, err)
+
+			expected, err := os.ReadFile(input)
+			assert.NoError(t, err)
+			actual, err := os.ReadFile(output)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+
+			info, err := os.Stat(output)
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+			// Blocks are always counted in 512 byte units.
+			diskUsage := info.Sys().(*syscall.Stat_t).Blocks * 512
+			assert.Less(t, diskUsage, info.Size())
+		})
+	}
+}
+
+func TestSparseCopyTrailingZeros(t *testing.T) {
+	const size = 1024 * 1024
+
+	input := filepath.Join(t.TempDir(), "zeros.raw")
+	err := os.WriteFile(input, make([]byte, size), 0o644)
+	assert.NoError(t, err)
+
+	output := filepath.Join(t.TempDir(), "zeros.raw")
+	err = NewRaw().Convert(input, output, true)
+	assert.NoError(t, err)
+
+	info, err := os.Stat(output)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size), info.Size())
+}
+
+// decompressWithTool decompresses compressedFile with the host's `tool -d` and returns the result.
+func decompressWithTool(t *testing.T, tool, compressedFile string) []byte {
+	decompressed, err := exec.Command(tool, "-d", "-c", compressedFile).Output()
+	assert.NoError(t, err)
+	return decompressed
+}
+
+func TestLz4Convert(t *testing.T) {
+	requireCommand(t, "lz4")
+
+	input := createRawFixture(t)
+
+	converter := NewLz4()
+	assert.Equal(t, "lz4", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	expected, err := os.ReadFile(input)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decompressWithTool(t, "lz4", output))
+}
+
+func TestLz4ConvertRequiresFile(t *testing.T) {
+	err := NewLz4().Convert(t.TempDir(), filepath.Join(t.TempDir(), "disk.lz4"), false)
+	assert.Error(t, err)
+}
+
+func TestTarLz4Convert(t *testing.T) {
+	requireCommand(t, "lz4")
+
+	input := createRawFixture(t)
+
+	converter := NewTarLz4()
+	assert.Equal(t, "tar.lz4", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	tarReader := tar.NewReader(bytes.NewReader(decompressWithTool(t, "lz4", output)))
+	header, err := tarReader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Base(input), filepath.Base(header.Name))
+}
+
+func TestTarLz4ConvertKeepsXattrs(t *testing.T) {
+	requireCommand(t, "lz4")
+
+	input := createXattrFixture(t)
+	output := filepath.Join(t.TempDir(), "rootfs.tar.lz4")
+	err := NewTarLz4().Convert(input, output, false)
+	assert.NoError(t, err)
+
+	assertTarKeepsXattrs(t, bytes.NewReader(decompressWithTool(t, "lz4", output)))
+}
+
+func TestBzip2Convert(t *testing.T) {
+	requireCommand(t, "bzip2")
+
+	input := createRawFixture(t)
+
+	converter := NewBzip2()
+	assert.Equal(t, "bz2", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	expected, err := os.ReadFile(input)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decompressWithTool(t, "bzip2", output))
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	assertDecompressesTo(t, bzip2.NewReader(compressedFile), input)
+}
+
+func TestBzip2ConvertRequiresFile(t *testing.T) {
+	err := NewBzip2().Convert(t.TempDir(), filepath.Join(t.TempDir(), "disk.bz2"), false)
+	assert.Error(t, err)
+}
+
+func TestTarBzip2Convert(t *testing.T) {
+	requireCommand(t, "bzip2")
+
+	input := createRawFixture(t)
+
+	converter := NewTarBzip2()
+	assert.Equal(t, "tar.bz2", converter.Extension())
+
+	output := filepath.Join(t.TempDir(), "disk."+converter.Extension())
+	err := converter.Convert(input, output, true)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	tarReader := tar.NewReader(bzip2.NewReader(compressedFile))
+	header, err := tarReader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Base(input), filepath.Base(header.Name))
+}
+
+func TestTarBzip2ConvertKeepsXattrs(t *testing.T) {
+	requireCommand(t, "bzip2")
+
+	input := createXattrFixture(t)
+	output := filepath.Join(t.TempDir(), "rootfs.tar.bz2")
+	err := NewTarBzip2().Convert(input, output, false)
+	assert.NoError(t, err)
+
+	compressedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer compressedFile.Close()
+
+	assertTarKeepsXattrs(t, bzip2.NewReader(compressedFile))
+}
+
+func TestVhdQemuImgArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		generation2  bool
+		subformat    string
+		expectedArgs []string
+	}{
+		{
+			name:         "vhd default is fixed",
+			expectedArgs: []string{"convert", "in", "out", "-o", "subformat=fixed,force_size", "-O", "vpc"},
+		},
+		{
+			name:         "vhd dynamic",
+			subformat:    VhdSubformatDynamic,
+			expectedArgs: []string{"convert", "in", "out", "-o", "subformat=dynamic,force_size", "-O", "vpc"},
+		},
+		{
+			name:         "vhdx default",
+			generation2:  true,
+			expectedArgs: []string{"convert", "in", "out", "-O", "vhdx"},
+		},
+		{
+			name:         "vhdx fixed",
+			generation2:  true,
+			subformat:    VhdSubformatFixed,
+			expectedArgs: []string{"convert", "in", "out", "-o", "subformat=fixed", "-O", "vhdx"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := NewVhd(tt.generation2, tt.subformat).qemuImgArgs("in", "out")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestVhdQemuImgArgsUnsupportedSubformat(t *testing.T) {
+	_, err := NewVhd(false, "differencing").qemuImgArgs("in", "out")
+	assert.ErrorContains(t, err, "unsupported vhd subformat")
+}
+
+func TestVhdConvertSubformats(t *testing.T) {
+	const footerSize = 512
+	requireCommand(t, "qemu-img")
+
+	// Every vhd ends with a footer starting with this cookie. Dynamic vhds also start with a copy of the footer.
+	vhdCookie := []byte("conectix")
+
+	for _, subformat := range VhdSubformats() {
+		t.Run(subformat, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "disk.vhd")
+			err := NewVhd(false, subformat).Convert(createRawFixture(t), output, true)
+			assert.NoError(t, err)
+
+			data, err := os.ReadFile(output)
+			assert.NoError(t, err)
+			assert.Equal(t, vhdCookie, data[len(data)-footerSize:][:len(vhdCookie)])
+
+			startsWithFooter := bytes.Equal(vhdCookie, data[:len(vhdCookie)])
+			assert.Equal(t, subformat == VhdSubformatDynamic, startsWithFooter)
+		})
+	}
+}
+
+func TestDiffVerify(t *testing.T) {
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	contents := []byte("upper dir file")
+	err := tarWriter.WriteHeader(&tar.Header{Name: "./etc/hostname", Mode: 0o644, Size: int64(len(contents))})
+	assert.NoError(t, err)
+	_, err = tarWriter.Write(contents)
+	assert.NoError(t, err)
+	assert.NoError(t, tarWriter.Close())
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.diff")
+	truncated := filepath.Join(dir, "truncated.diff")
+	empty := filepath.Join(dir, "empty.diff")
+	assert.NoError(t, os.WriteFile(valid, archive.Bytes(), 0o644))
+	assert.NoError(t, os.WriteFile(truncated, archive.Bytes()[:520], 0o644))
+	assert.NoError(t, os.WriteFile(empty, nil, 0o644))
+
+	assert.NoError(t, NewDiff().Verify(valid))
+	assert.Error(t, NewDiff().Verify(truncated))
+	assert.ErrorContains(t, NewDiff().Verify(empty), "is empty")
+}
+
+func TestRdiffVerify(t *testing.T) {
+	requireCommand(t, "rdiff")
+
+	dir := t.TempDir()
+	base := createRawFixture(t)
+	target := filepath.Join(dir, "target.raw")
+	signature := filepath.Join(dir, "signature")
+	delta := filepath.Join(dir, "disk.rdiff")
+
+	data, err := os.ReadFile(base)
+	assert.NoError(t, err)
+	copy(data[8192:], "changed data")
+	assert.NoError(t, os.WriteFile(target, data, 0o644))
+
+	assert.NoError(t, exec.Command("rdiff", "signature", base, signature).Run())
+	assert.NoError(t, exec.Command("rdiff", "delta", signature, target, delta).Run())
+
+	targetSHA256, err := file.GenerateSHA256(target)
+	assert.NoError(t, err)
+
+	assert.NoError(t, NewRdiff().Verify(delta, base, targetSHA256, t.TempDir()))
+
+	baseSHA256, err := file.GenerateSHA256(base)
+	assert.NoError(t, err)
+	err = NewRdiff().Verify(delta, base, baseSHA256, t.TempDir())
+	assert.ErrorContains(t, err, "does not reconstruct the expected image")
+}
@@ -16,6 +16,7 @@ const GzipType = "gz"
 
 // Gzip implements Converter interface to convert a RAW image into a gzipped file
 type Gzip struct {
+	threads int
 }
 
 // Convert converts the image in the Gzip format
@@ -36,9 +37,17 @@ func (g *Gzip) Convert(input, output string, isInputFile bool) (err error) {
 	}
 	defer dstFile.Close()
 
+	const blockSize = 1024 * 1024
+
 	gzipWriter := pgzip.NewWriter(dstFile)
 	defer gzipWriter.Close()
 
+	// pgzip compresses independent blocks in parallel, the output is still a single standard gzip stream.
+	err = gzipWriter.SetConcurrency(blockSize, g.threads)
+	if err != nil {
+		return
+	}
+
 	_, err = io.Copy(gzipWriter, srcFile)
 	return
 }
@@ -48,7 +57,10 @@ func (g *Gzip) Extension() string {
 	return GzipType
 }
 
-// NewGzip returns a new Gzip format encoder
-func NewGzip() *Gzip {
-	return &Gzip{}
+// NewGzip returns a new Gzip format encoder which compresses using up to `threads` goroutines. If threads is not
+// positive, one goroutine per CPU is used.
+func NewGzip(threads int) *Gzip {
+	return &Gzip{
+		threads: compressionThreads(threads),
+	}
 }
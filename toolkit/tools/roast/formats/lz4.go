@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import (
+	"fmt"
+	"os"
+)
+
+// Lz4Type represents the lz4 format
+const Lz4Type = "lz4"
+
+// Lz4 implements Converter interface to convert a RAW image into a lz4 file
+type Lz4 struct {
+}
+
+// Convert converts the image in the lz4 format
+func (l *Lz4) Convert(input, output string, isInputFile bool) (err error) {
+	if !isInputFile {
+		return fmt.Errorf("lz4 compression requires a file as an input")
+	}
+
+	srcFile, err := os.Open(input)
+	if err != nil {
+		return
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(output)
+	if err != nil {
+		return
+	}
+	defer dstFile.Close()
+
+	return compressWithTool(srcFile, dstFile, "lz4", "--compress", "--stdout")
+}
+
+// Tools returns the external programs run by this converter.
+func (l *Lz4) Tools() []string {
+	return []string{"lz4"}
+}
+
+// Extension returns the filetype extension produced by this converter.
+func (l *Lz4) Extension() string {
+	return Lz4Type
+}
+
+// NewLz4 returns a new lz4 format encoder
+func NewLz4() *Lz4 {
+	return &Lz4{}
+}
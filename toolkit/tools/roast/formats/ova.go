@@ -199,6 +199,11 @@ func (o *Ova) Convert(input, output string, isInputFile bool) (err error) {
 	return
 }
 
+// Tools returns the external programs run by this converter.
+func (o *Ova) Tools() []string {
+	return []string{"qemu-img", "sed", "ovftool", "openssl", "tar"}
+}
+
 // Extension returns the filetype extension produced by this converter.
 func (o *Ova) Extension() string {
 	return OvaType
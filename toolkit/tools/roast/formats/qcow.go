@@ -33,6 +33,11 @@ func (v *Qcow) Convert(input, output string, isInputFile bool) (err error) {
 	return
 }
 
+// Tools returns the external programs run by this converter.
+func (v *Qcow) Tools() []string {
+	return []string{"qemu-img"}
+}
+
 // Extension returns the filetype extension produced by this converter.
 func (v *Qcow) Extension() string {
 	return QcowType
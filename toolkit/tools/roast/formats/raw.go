@@ -3,11 +3,7 @@
 
 package formats
 
-import (
-	"fmt"
-
-	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
-)
+import "fmt"
 
 // RawType represents the raw format (no conversion)
 const RawType = "raw"
@@ -16,12 +12,12 @@ const RawType = "raw"
 type Raw struct {
 }
 
-// Convert simply makes a copy of the RAW image
+// Convert simply makes a sparse copy of the RAW image
 func (r *Raw) Convert(input, output string, isInputFile bool) (err error) {
 	if !isInputFile {
 		return fmt.Errorf("raw conversion requires a RAW file as an input")
 	}
-	err = file.Copy(input, output)
+	err = copySparse(input, output)
 	return
 }
 
@@ -5,8 +5,11 @@ package formats
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
 )
 
 // RdiffType represents the rdiff file system format
@@ -25,6 +28,35 @@ func (e *Rdiff) Convert(input, output string, isInputFile bool) (err error) {
 	return
 }
 
+// Verify applies the rdiff delta to baseImage and checks that the reconstructed image has the expected SHA256
+// checksum. The reconstructed image is written to a temporary directory under tmpDir and removed afterwards.
+func (e *Rdiff) Verify(delta, baseImage, expectedSHA256, tmpDir string) (err error) {
+	const squashErrors = false
+
+	verifyDir, err := os.MkdirTemp(tmpDir, "rdiff-verify-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(verifyDir)
+
+	reconstructed := filepath.Join(verifyDir, "reconstructed.raw")
+	err = shell.ExecuteLive(squashErrors, "rdiff", "patch", baseImage, delta, reconstructed)
+	if err != nil {
+		return fmt.Errorf("failed to apply rdiff delta (%s) to (%s):\n%w", delta, baseImage, err)
+	}
+
+	actualSHA256, err := file.GenerateSHA256(reconstructed)
+	if err != nil {
+		return
+	}
+
+	if actualSHA256 != expectedSHA256 {
+		return fmt.Errorf("rdiff delta (%s) does not reconstruct the expected image: sha256 is (%s), expected (%s)", delta, actualSHA256, expectedSHA256)
+	}
+
+	return
+}
+
 // Extension returns the filetype extension produced by this converter.
 func (e *Rdiff) Extension() string {
 	return RdiffType
@@ -0,0 +1,67 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// sparseBlockSize is the granularity at which runs of zeros are detected. It matches the block size of common file
+// systems so every skipped block becomes a hole.
+const sparseBlockSize = 4096
+
+// copySparse copies input to output, seeking over blocks of zeros instead of writing them so output is sparse.
+// output keeps input's permissions and apparent size.
+func copySparse(input, output string) (err error) {
+	srcFile, err := os.Open(input)
+	if err != nil {
+		return
+	}
+	defer srcFile.Close()
+
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return
+	}
+
+	dstFile, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, srcInfo.Mode().Perm())
+	if err != nil {
+		return
+	}
+	defer dstFile.Close()
+
+	zeroBlock := make([]byte, sparseBlockSize)
+	block := make([]byte, sparseBlockSize)
+	for {
+		var bytesRead int
+		bytesRead, err = io.ReadFull(srcFile, block)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("failed to read (%s):\n%w", input, err)
+		}
+
+		if bytes.Equal(block[:bytesRead], zeroBlock[:bytesRead]) {
+			_, err = dstFile.Seek(int64(bytesRead), io.SeekCurrent)
+		} else {
+			_, err = dstFile.Write(block[:bytesRead])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write (%s):\n%w", output, err)
+		}
+	}
+
+	// Seeking past the end doesn't extend a file, set the size explicitly in case it ends with a hole.
+	err = dstFile.Truncate(srcInfo.Size())
+	if err != nil {
+		return fmt.Errorf("failed to set the size of (%s):\n%w", output, err)
+	}
+
+	return dstFile.Close()
+}
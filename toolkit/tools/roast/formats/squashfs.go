@@ -21,6 +21,11 @@ func (t *SquashFS) Convert(input, output string, isInputFile bool) (err error) {
 	return
 }
 
+// Tools returns the external programs run by this converter.
+func (t *SquashFS) Tools() []string {
+	return []string{"mksquashfs"}
+}
+
 // Extension returns the filetype extension produced by this converter.
 func (t *SquashFS) Extension() string {
 	return SquashFSType
@@ -0,0 +1,22 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import "github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+
+// createTarball archives input into output, compressing it with compressTool. Extended attributes and SELinux labels
+// are kept so archived root filesystems keep their labels and file capabilities. A directory input is archived from
+// within, so its entries have no leading directory.
+func createTarball(compressTool, input, output string, isInputFile bool) (err error) {
+	const squashErrors = false
+
+	args := []string{"--xattrs", "--selinux", "-I", compressTool, "-cf", output}
+	if isInputFile {
+		args = append(args, input)
+	} else {
+		args = append(args, "-C", input, ".")
+	}
+
+	return shell.ExecuteLive(squashErrors, "tar", args...)
+}
@@ -0,0 +1,38 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import "github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+
+// TarBzip2Type represents the tar.bz2 format
+const TarBzip2Type = "tar.bz2"
+
+// TarBzip2 implements Converter interface to convert a RAW image into a tar.bz2 file
+type TarBzip2 struct {
+}
+
+// Convert converts the image in the tar.bz2 format
+func (t *TarBzip2) Convert(input, output string, isInputFile bool) (err error) {
+	tool, err := systemdependency.Bzip2Tool()
+	if err != nil {
+		return
+	}
+
+	return createTarball(tool, input, output, isInputFile)
+}
+
+// Tools returns the external programs run by this converter.
+func (t *TarBzip2) Tools() []string {
+	return []string{"tar", lookupToolName(systemdependency.Bzip2Tool, "bzip2")}
+}
+
+// Extension returns the filetype extension produced by this converter.
+func (t *TarBzip2) Extension() string {
+	return TarBzip2Type
+}
+
+// NewTarBzip2 returns a new TarBzip2 format encoder
+func NewTarBzip2() *TarBzip2 {
+	return &TarBzip2{}
+}
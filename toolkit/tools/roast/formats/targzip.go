@@ -3,10 +3,7 @@
 
 package formats
 
-import (
-	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
-	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
-)
+import "github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
 
 // TarGzipType represents the tar.gz format
 const TarGzipType = "tar.gz"
@@ -17,20 +14,17 @@ type TarGzip struct {
 
 // Convert converts the image in the tar.gz format
 func (t *TarGzip) Convert(input, output string, isInputFile bool) (err error) {
-	const squashErrors = false
-
 	tool, err := systemdependency.GzipTool()
 	if err != nil {
 		return
 	}
 
-	if isInputFile {
-		err = shell.ExecuteLive(squashErrors, "tar", "--xattrs", "--selinux", "-I", tool, "-cf", output, input)
-	} else {
-		err = shell.ExecuteLive(squashErrors, "tar", "--xattrs", "--selinux", "-I", tool, "-cf", output, "-C", input, ".")
-	}
+	return createTarball(tool, input, output, isInputFile)
+}
 
-	return
+// Tools returns the external programs run by this converter.
+func (t *TarGzip) Tools() []string {
+	return []string{"tar", lookupToolName(systemdependency.GzipTool, "gzip")}
 }
 
 // Extension returns the filetype extension produced by this converter.
@@ -0,0 +1,31 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+// TarLz4Type represents the tar.lz4 format
+const TarLz4Type = "tar.lz4"
+
+// TarLz4 implements Converter interface to convert a RAW image into a tar.lz4 file
+type TarLz4 struct {
+}
+
+// Convert converts the image in the tar.lz4 format
+func (t *TarLz4) Convert(input, output string, isInputFile bool) (err error) {
+	return createTarball("lz4", input, output, isInputFile)
+}
+
+// Tools returns the external programs run by this converter.
+func (t *TarLz4) Tools() []string {
+	return []string{"tar", "lz4"}
+}
+
+// Extension returns the filetype extension produced by this converter.
+func (t *TarLz4) Extension() string {
+	return TarLz4Type
+}
+
+// NewTarLz4 returns a new TarLz4 format encoder
+func NewTarLz4() *TarLz4 {
+	return &TarLz4{}
+}
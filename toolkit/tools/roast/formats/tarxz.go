@@ -19,6 +19,11 @@ func (t *TarXz) Convert(input, output string, isInputFile bool) (err error) {
 	return
 }
 
+// Tools returns the external programs run by this converter.
+func (t *TarXz) Tools() []string {
+	return []string{"tar", "xz"}
+}
+
 // Extension returns the filetype extension produced by this converter.
 func (t *TarXz) Extension() string {
 	return TarXzType
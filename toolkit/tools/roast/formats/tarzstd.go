@@ -0,0 +1,31 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+// TarZstdType represents the tar.zst format
+const TarZstdType = "tar.zst"
+
+// TarZstd implements Converter interface to convert a RAW image into a tar.zst file
+type TarZstd struct {
+}
+
+// Convert converts the image in the tar.zst format
+func (t *TarZstd) Convert(input, output string, isInputFile bool) (err error) {
+	return createTarball("zstd", input, output, isInputFile)
+}
+
+// Tools returns the external programs run by this converter.
+func (t *TarZstd) Tools() []string {
+	return []string{"tar", "zstd"}
+}
+
+// Extension returns the filetype extension produced by this converter.
+func (t *TarZstd) Extension() string {
+	return TarZstdType
+}
+
+// NewTarZstd returns a new TarZstd format encoder
+func NewTarZstd() *TarZstd {
+	return &TarZstd{}
+}
@@ -5,6 +5,7 @@ package formats
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
 )
@@ -15,17 +16,23 @@ const (
 
 	// VhdxType represents the vhdx virtual drive format
 	VhdxType = "vhdx"
+
+	// VhdSubformatFixed is a VHD(x) which allocates the whole disk up front
+	VhdSubformatFixed = "fixed"
+
+	// VhdSubformatDynamic is a VHD(x) which only grows as data is written to it
+	VhdSubformatDynamic = "dynamic"
 )
 
 // Vhd implements Converter interface to convert a RAW image into a VHD(x) file
 type Vhd struct {
 	generation2 bool
+	subformat   string
 }
 
 // Convert converts the image in the VHD(x) format
 func (v *Vhd) Convert(input, output string, isInputFile bool) (err error) {
 	const (
-		qemuVhdType  = "vpc"
 		squashErrors = false
 	)
 
@@ -33,22 +40,54 @@ func (v *Vhd) Convert(input, output string, isInputFile bool) (err error) {
 		return fmt.Errorf("vhd conversion requires a RAW file as an input")
 	}
 
+	args, err := v.qemuImgArgs(input, output)
+	if err != nil {
+		return
+	}
+
+	err = shell.ExecuteLive(squashErrors, "qemu-img", args...)
+	return
+}
+
+// qemuImgArgs returns the arguments for 'qemu-img' to convert input into output.
+func (v *Vhd) qemuImgArgs(input, output string) (args []string, err error) {
+	const (
+		qemuVhdType = "vpc"
+	)
+
+	if v.subformat != "" && !slices.Contains(VhdSubformats(), v.subformat) {
+		return nil, fmt.Errorf("unsupported vhd subformat (%s), supported subformats are %v", v.subformat, VhdSubformats())
+	}
+
 	var format string
-	args := []string{"convert", input, output}
+	args = []string{"convert", input, output}
 
 	if v.generation2 {
 		format = VhdxType
+		// Without a subformat qemu-img creates a dynamic vhdx.
+		if v.subformat != "" {
+			args = append(args, "-o", "subformat="+v.subformat)
+		}
 	} else {
 		format = qemuVhdType
-		args = append(args, "-o", "subformat=fixed,force_size")
+		// Without a subformat a fixed vhd is created. force_size keeps the virtual size identical to the raw image's
+		// instead of rounding it to the legacy CHS geometry.
+		subformat := v.subformat
+		if subformat == "" {
+			subformat = VhdSubformatFixed
+		}
+		args = append(args, "-o", fmt.Sprintf("subformat=%s,force_size", subformat))
 	}
 
 	args = append(args, "-O", format)
-
-	err = shell.ExecuteLive(squashErrors, "qemu-img", args...)
 	return
 }
 
+// Tools returns the external programs run by this converter.
+func (v *Vhd) Tools() []string {
+	return []string{"qemu-img"}
+}
+
 // Extension returns the filetype extension produced by this converter.
 func (v *Vhd) Extension() string {
 	if v.generation2 {
@@ -58,9 +97,15 @@ func (v *Vhd) Extension() string {
 	return VhdType
 }
 
-// NewVhd returns a new Vhd(x) format encoder
-func NewVhd(generation2 bool) *Vhd {
+// NewVhd returns a new Vhd(x) format encoder. An empty subformat produces a fixed vhd or a dynamic vhdx.
+func NewVhd(generation2 bool, subformat string) *Vhd {
 	return &Vhd{
 		generation2: generation2,
+		subformat:   subformat,
 	}
 }
+
+// VhdSubformats returns the supported VHD(x) subformats
+func VhdSubformats() []string {
+	return []string{VhdSubformatFixed, VhdSubformatDynamic}
+}
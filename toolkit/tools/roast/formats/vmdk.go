@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+)
+
+const (
+	// VmdkType represents the VMware vmdk virtual drive format
+	VmdkType = "vmdk"
+
+	// VmdkStreamOptimized is a compressed, single file vmdk suitable for distribution and OVF/OVA packages
+	VmdkStreamOptimized = "streamOptimized"
+
+	// VmdkMonolithicSparse is a growable, single file vmdk suitable for running a VM directly from
+	VmdkMonolithicSparse = "monolithicSparse"
+
+	// VmdkDefaultSubformat is the vmdk subformat used if none is specified
+	VmdkDefaultSubformat = VmdkStreamOptimized
+)
+
+// Vmdk implements Converter interface to convert a RAW image into a vmdk file
+type Vmdk struct {
+	subformat string
+}
+
+// Convert converts the image in the vmdk format
+func (v *Vmdk) Convert(input, output string, isInputFile bool) (err error) {
+	const (
+		squashErrors = false
+	)
+
+	if !isInputFile {
+		return fmt.Errorf("vmdk conversion requires a RAW file as an input")
+	}
+
+	if !slices.Contains(VmdkSubformats(), v.subformat) {
+		return fmt.Errorf("unsupported vmdk subformat (%s), supported subformats are %v", v.subformat, VmdkSubformats())
+	}
+
+	err = shell.ExecuteLive(squashErrors, "qemu-img", "convert", "-O", VmdkType, "-o", "subformat="+v.subformat, input, output)
+	return
+}
+
+// Tools returns the external programs run by this converter.
+func (v *Vmdk) Tools() []string {
+	return []string{"qemu-img"}
+}
+
+// Extension returns the filetype extension produced by this converter.
+func (v *Vmdk) Extension() string {
+	return VmdkType
+}
+
+// NewVmdk returns a new vmdk format encoder producing the given subformat
+func NewVmdk(subformat string) *Vmdk {
+	return &Vmdk{
+		subformat: subformat,
+	}
+}
+
+// VmdkSubformats returns the supported vmdk subformats
+func VmdkSubformats() []string {
+	return []string{VmdkStreamOptimized, VmdkMonolithicSparse}
+}
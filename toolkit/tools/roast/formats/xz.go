@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"strconv"
 
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
 	"github.com/ulikunitz/xz"
 )
 
@@ -16,12 +19,12 @@ const XzType = "xz"
 
 // Xz implements Converter interface to convert a RAW image into a xz file
 type Xz struct {
+	threads int
 }
 
-// Convert converts the image in the xz format
+// Convert converts the image in the xz format. The multi-threaded xz tool is used if it is available on the host,
+// otherwise the image is compressed on a single thread.
 func (x *Xz) Convert(input, output string, isInputFile bool) (err error) {
-	const squashErrors = false
-
 	if !isInputFile {
 		return fmt.Errorf("xz compression requires a file as an input")
 	}
@@ -38,15 +41,22 @@ func (x *Xz) Convert(input, output string, isInputFile bool) (err error) {
 	}
 	defer dstFile.Close()
 
-	xzWriter, err := xz.NewWriter(dstFile)
+	xzTool, err := exec.LookPath("xz")
 	if err != nil {
-		return
+		logger.Log.Debugf("xz tool not found, compressing (%s) on a single thread", input)
+		return compressXz(srcFile, dstFile)
 	}
-	defer xzWriter.Close()
 
-	_, err = io.Copy(xzWriter, srcFile)
+	return compressWithTool(srcFile, dstFile, xzTool, "--compress", "--stdout", "--threads", strconv.Itoa(x.threads))
+}
 
-	return
+// Tools returns the external programs run by this converter, none if the xz tool is missing and the image is
+// compressed in-process.
+func (x *Xz) Tools() []string {
+	if _, err := exec.LookPath("xz"); err != nil {
+		return nil
+	}
+	return []string{"xz"}
 }
 
 // Extension returns the filetype extension produced by this converter.
@@ -54,7 +64,22 @@ func (x *Xz) Extension() string {
 	return XzType
 }
 
-// NewXz returns a new xz format encoder
-func NewXz() *Xz {
-	return &Xz{}
+// NewXz returns a new xz format encoder which compresses using up to `threads` threads. If threads is not positive,
+// one thread per CPU is used.
+func NewXz(threads int) *Xz {
+	return &Xz{
+		threads: compressionThreads(threads),
+	}
+}
+
+// compressXz compresses src into dst on the calling goroutine.
+func compressXz(src io.Reader, dst io.Writer) (err error) {
+	xzWriter, err := xz.NewWriter(dst)
+	if err != nil {
+		return
+	}
+	defer xzWriter.Close()
+
+	_, err = io.Copy(xzWriter, src)
+	return
 }
@@ -0,0 +1,57 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package formats
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdType represents the zstd format
+const ZstdType = "zst"
+
+// Zstd implements Converter interface to convert a RAW image into a zstd file
+type Zstd struct {
+}
+
+// Convert converts the image in the zstd format
+func (z *Zstd) Convert(input, output string, isInputFile bool) (err error) {
+	if !isInputFile {
+		return fmt.Errorf("zst compression requires a file as an input")
+	}
+
+	srcFile, err := os.Open(input)
+	if err != nil {
+		return
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(output)
+	if err != nil {
+		return
+	}
+	defer dstFile.Close()
+
+	zstdWriter, err := zstd.NewWriter(dstFile)
+	if err != nil {
+		return
+	}
+	defer zstdWriter.Close()
+
+	_, err = io.Copy(zstdWriter, srcFile)
+	return
+}
+
+// Extension returns the filetype extension produced by this converter.
+func (z *Zstd) Extension() string {
+	return ZstdType
+}
+
+// NewZstd returns a new zstd format encoder
+func NewZstd() *Zstd {
+	return &Zstd{}
+}
@@ -10,10 +10,13 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/configuration"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/exe"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/jsonutils"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/timestamp"
 	"github.com/microsoft/azurelinux/toolkit/tools/pkg/profile"
@@ -29,12 +32,46 @@ type convertRequest struct {
 	isInputFile bool
 	artifact    configuration.Artifact
 	timestamp   *timestamp.TimeStamp
+	// baseImage is the image a diff or rdiff input is a delta against. It is empty when the input is not a delta.
+	baseImage string
+}
+
+// converterOptions are the settings applied to the conversion of every artifact.
+type converterOptions struct {
+	// compressionThreads is the number of threads each gz/xz compression may use.
+	compressionThreads int
+	// vmdkSubformat is the vmdk subformat to produce, see formats.VmdkSubformats.
+	vmdkSubformat string
+	// vhdSubformat is the VHD(x) subformat to produce, see formats.VhdSubformats. Empty uses the format's default.
+	vhdSubformat string
+	// verifyDeltas checks diff and rdiff deltas after they are converted, failing the artifact if they are bad.
+	verifyDeltas bool
+	// generateChecksums writes a '<artifact>.sha256' checksum file next to each converted artifact.
+	generateChecksums bool
+	// manifestFile is the path to write a JSON manifest of the conversion results to. Empty skips the manifest.
+	manifestFile string
+	// dryRun only logs the planned conversions, without converting or writing any files.
+	dryRun bool
 }
 
 type convertResult struct {
 	artifactName  string
+	artifactType  string
+	compression   string
 	originalPath  string
 	convertedFile string
+	err           error
+}
+
+// manifestEntry describes a single artifact in the manifest written by --manifest.
+type manifestEntry struct {
+	ArtifactName  string  `json:"ArtifactName"`
+	Type          string  `json:"Type"`
+	Compression   string  `json:"Compression"`
+	OriginalPath  string  `json:"OriginalPath"`
+	ConvertedFile *string `json:"ConvertedFile"`
+	Size          int64   `json:"Size"`
+	Error         string  `json:"Error,omitempty"`
 }
 
 var (
@@ -56,6 +93,18 @@ var (
 	imageTag = app.Flag("image-tag", "Tag (text) appended to the image name. Empty by default.").String()
 
 	timestampFile = app.Flag("timestamp-file", "File that stores timestamps for this program.").String()
+
+	checksums = app.Flag("checksums", "Write a <artifact>.sha256 checksum file next to each converted artifact.").Bool()
+
+	manifestFile = app.Flag("manifest", "Path to write a JSON manifest of the produced artifacts to.").String()
+
+	dryRun = app.Flag("dry-run", "Log the planned conversions without converting or writing any files.").Bool()
+
+	compressionThreads = app.Flag("compression-threads", "Number of threads each gz/xz compression may use. Defaults to the number of CPUs divided by --workers.").Int()
+
+	vmdkSubformat = app.Flag("vmdk-subformat", "Subformat of vmdk artifacts.").Default(formats.VmdkDefaultSubformat).PlaceHolder(exe.PlaceHolderize(formats.VmdkSubformats())).Enum(formats.VmdkSubformats()...)
+	verifyDeltas  = app.Flag("verify-deltas", "Check diff and rdiff deltas after converting them. rdiff deltas are applied to their base image and the result is compared to the partition checksum the imager records with --rdiff-target-checksums.").Bool()
+	vhdSubformat  = app.Flag("vhd-subformat", "Subformat of vhd and vhdx artifacts. Defaults to fixed for vhd and dynamic for vhdx.").PlaceHolder(exe.PlaceHolderize(formats.VhdSubformats())).Enum(formats.VhdSubformats()...)
 )
 
 func main() {
@@ -76,49 +125,82 @@ func main() {
 		logger.Log.Panicf("Value in --workers must be greater than zero. Found %d", *workers)
 	}
 
-	inDirPath, err := filepath.Abs(*inputDir)
+	if *compressionThreads < 0 {
+		logger.Log.Panicf("Value in --compression-threads must not be negative. Found %d", *compressionThreads)
+	}
+
+	inDirPath, outDirPath, tmpDirPath, err := absoluteDirPaths(*inputDir, *outputDir, *tmpDir)
 	if err != nil {
-		logger.Log.Panicf("Error when calculating input directory path: %s", err)
+		logger.Log.Panic(err)
 	}
 
-	outDirPath, err := filepath.Abs(*outputDir)
+	if !*dryRun {
+		err = os.MkdirAll(outDirPath, os.ModePerm)
+		if err != nil {
+			logger.Log.Panicf("Error when creating output directory. Error: %s", err)
+		}
+	}
+
+	config, err := configuration.Load(*configFile)
 	if err != nil {
-		logger.Log.Panicf("Error when calculating absolute output path: %s", err)
+		logger.Log.Panicf("Failed loading image configuration. Error: %s", err)
 	}
 
-	tmpDirPath, err := filepath.Abs(*outputDir)
+	options := converterOptions{
+		compressionThreads: *compressionThreads,
+		vmdkSubformat:      *vmdkSubformat,
+		vhdSubformat:       *vhdSubformat,
+		verifyDeltas:       *verifyDeltas,
+		generateChecksums:  *checksums,
+		manifestFile:       *manifestFile,
+		dryRun:             *dryRun,
+	}
+
+	err = generateImageArtifacts(*workers, options, inDirPath, outDirPath, *releaseVersion, *imageTag, tmpDirPath, config)
 	if err != nil {
-		logger.Log.Panicf("Error when calculating absolute temporary path: %s", err)
+		logger.Log.Panic(err)
 	}
+}
 
-	err = os.MkdirAll(outDirPath, os.ModePerm)
+// absoluteDirPaths converts the input, output and temporary directories to absolute paths.
+func absoluteDirPaths(inputDir, outputDir, tmpDir string) (inDirPath, outDirPath, tmpDirPath string, err error) {
+	inDirPath, err = filepath.Abs(inputDir)
 	if err != nil {
-		logger.Log.Panicf("Error when creating output directory. Error: %s", err)
+		err = fmt.Errorf("error when calculating input directory path: %w", err)
+		return
 	}
 
-	config, err := configuration.Load(*configFile)
+	outDirPath, err = filepath.Abs(outputDir)
 	if err != nil {
-		logger.Log.Panicf("Failed loading image configuration. Error: %s", err)
+		err = fmt.Errorf("error when calculating absolute output path: %w", err)
+		return
 	}
 
-	err = generateImageArtifacts(*workers, inDirPath, outDirPath, *releaseVersion, *imageTag, tmpDirPath, config)
+	tmpDirPath, err = filepath.Abs(tmpDir)
 	if err != nil {
-		logger.Log.Panic(err)
+		err = fmt.Errorf("error when calculating absolute temporary path: %w", err)
+		return
 	}
+
+	return
 }
 
-func generateImageArtifacts(workers int, inDir, outDir, releaseVersion, imageTag, tmpDir string, config configuration.Config) (err error) {
+func generateImageArtifacts(workers int, options converterOptions, inDir, outDir, releaseVersion, imageTag, tmpDir string, config configuration.Config) (err error) {
 	const defaultSystemConfig = 0
 	timestamp.StartEvent("generate artifacts", nil)
 	defer timestamp.StopEvent(nil)
 
-	err = os.MkdirAll(tmpDir, os.ModePerm)
-	if err != nil {
-		return
+	if options.dryRun {
+		logger.Log.Info("Dry run, no artifacts will be converted")
+	} else {
+		err = os.MkdirAll(tmpDir, os.ModePerm)
+		if err != nil {
+			return
+		}
 	}
 
-	if len(config.Disks) > 1 {
-		err = fmt.Errorf("this program currently only supports one disk")
+	err = validateRootfsDisks(config.Disks)
+	if err != nil {
 		return
 	}
 
@@ -130,6 +212,10 @@ func generateImageArtifacts(workers int, inDir, outDir, releaseVersion, imageTag
 		}
 	}
 
+	if options.compressionThreads == 0 {
+		options.compressionThreads = defaultCompressionThreads(workers)
+	}
+
 	logger.Log.Infof("Converting (%d) artifacts", numberOfArtifacts)
 
 	convertRequests := make(chan *convertRequest, numberOfArtifacts)
@@ -139,7 +225,7 @@ func generateImageArtifacts(workers int, inDir, outDir, releaseVersion, imageTag
 
 	// Start the workers now so they begin working as soon as a new job is buffered.
 	for i := 0; i < workers; i++ {
-		go artifactConverterWorker(convertRequests, convertedResults, releaseVersion, tmpDir, imageTag, outDir)
+		go artifactConverterWorker(convertRequests, convertedResults, options, releaseVersion, tmpDir, imageTag, outDir)
 	}
 
 	for i, disk := range config.Disks {
@@ -157,13 +243,15 @@ func generateImageArtifacts(workers int, inDir, outDir, releaseVersion, imageTag
 		for j, partition := range disk.Partitions {
 			for _, artifact := range partition.Artifacts {
 				// Currently only process 1 system config
-				inputName, isFile := partitionArtifactInput(i, j, &artifact, retrievePartitionSettings(&config.SystemConfigs[defaultSystemConfig], partition.ID))
+				partitionSetting := retrievePartitionSettings(&config.SystemConfigs[defaultSystemConfig], partition.ID)
+				inputName, isFile := partitionArtifactInput(i, j, &artifact, partitionSetting)
 				ts, _ := timestamp.StartEvent("converting"+inputName, artifactTimeStampRoot)
 				convertRequests <- &convertRequest{
 					inputPath:   filepath.Join(inDir, inputName),
 					isInputFile: isFile,
 					artifact:    artifact,
 					timestamp:   ts,
+					baseImage:   deltaBaseImage(&artifact, partitionSetting),
 				}
 			}
 		}
@@ -174,15 +262,26 @@ func generateImageArtifacts(workers int, inDir, outDir, releaseVersion, imageTag
 	timestamp.StopEvent(artifactTimeStampRoot) // convert artifacts
 
 	failedArtifacts := []string{}
+	results := make([]*convertResult, 0, numberOfArtifacts)
 	for i := 0; i < numberOfArtifacts; i++ {
 		result := <-convertedResults
+		results = append(results, result)
 		if result.convertedFile == "" {
 			failedArtifacts = append(failedArtifacts, result.artifactName)
+		} else if options.dryRun {
+			logger.Log.Infof("[%d/%d] Would convert (%s) -> (%s)", (i + 1), numberOfArtifacts, result.originalPath, result.convertedFile)
 		} else {
 			logger.Log.Infof("[%d/%d] Converted (%s) -> (%s)", (i + 1), numberOfArtifacts, result.originalPath, result.convertedFile)
 		}
 	}
 
+	if options.manifestFile != "" && !options.dryRun {
+		err = writeManifest(options.manifestFile, results)
+		if err != nil {
+			return fmt.Errorf("failed to write manifest (%s):\n%w", options.manifestFile, err)
+		}
+	}
+
 	if len(failedArtifacts) != 0 {
 		err = fmt.Errorf("failed to generate the following artifacts: %v", failedArtifacts)
 	}
@@ -201,7 +300,7 @@ func retrievePartitionSettings(systemConfig *configuration.SystemConfig, searche
 	return
 }
 
-func artifactConverterWorker(convertRequests chan *convertRequest, convertedResults chan *convertResult, releaseVersion, tmpDir, imageTag, outDir string) {
+func artifactConverterWorker(convertRequests chan *convertRequest, convertedResults chan *convertResult, options converterOptions, releaseVersion, tmpDir, imageTag, outDir string) {
 	const (
 		initrdArtifactType = "initrd"
 	)
@@ -219,6 +318,8 @@ func artifactConverterWorker(convertRequests chan *convertRequest, convertedResu
 		}
 		result := &convertResult{
 			artifactName: fullArtifactName,
+			artifactType: req.artifact.Type,
+			compression:  req.artifact.Compression,
 			originalPath: req.inputPath,
 		}
 
@@ -227,21 +328,33 @@ func artifactConverterWorker(convertRequests chan *convertRequest, convertedResu
 
 		if req.artifact.Type != "" {
 			const appendExtension = false
-			outputFile, err := convertArtifact(fullArtifactName, tmpDir, req.artifact.Type, imageTag, workingArtifactPath, isInputFile, appendExtension)
+			outputFile, err := convertArtifact(fullArtifactName, tmpDir, req.artifact.Type, options, imageTag, workingArtifactPath, isInputFile, appendExtension)
 			if err != nil {
 				logger.Log.Errorf("Failed to convert artifact (%s) to type (%s). Error: %s", req.artifact.Name, req.artifact.Type, err)
+				result.err = err
 				convertedResults <- result
 				continue
 			}
 			isInputFile = true
 			workingArtifactPath = outputFile
+
+			if options.verifyDeltas && !options.dryRun {
+				err = verifyDelta(req, workingArtifactPath, tmpDir)
+				if err != nil {
+					logger.Log.Errorf("Failed to verify delta artifact (%s). Error: %s", req.artifact.Name, err)
+					result.err = err
+					convertedResults <- result
+					continue
+				}
+			}
 		}
 
 		if req.artifact.Compression != "" {
 			const appendExtension = true
-			outputFile, err := convertArtifact(fullArtifactName, tmpDir, req.artifact.Compression, imageTag, workingArtifactPath, isInputFile, appendExtension)
+			outputFile, err := convertArtifact(fullArtifactName, tmpDir, req.artifact.Compression, options, imageTag, workingArtifactPath, isInputFile, appendExtension)
 			if err != nil {
 				logger.Log.Errorf("Failed to compress (%s) using (%s). Error: %s", workingArtifactPath, req.artifact.Compression, err)
+				result.err = err
 				convertedResults <- result
 				continue
 			}
@@ -250,11 +363,25 @@ func artifactConverterWorker(convertRequests chan *convertRequest, convertedResu
 
 		if workingArtifactPath == req.inputPath {
 			logger.Log.Errorf("Artifact (%s) has no type or compression", req.artifact.Name)
+			result.err = fmt.Errorf("artifact (%s) has no type or compression", req.artifact.Name)
+		} else if options.dryRun {
+			finalFile := filepath.Join(outDir, filepath.Base(workingArtifactPath))
+			logger.Log.Infof("Would move (%s) to (%s)", workingArtifactPath, finalFile)
+			result.convertedFile = finalFile
 		} else {
 			finalFile := filepath.Join(outDir, filepath.Base(workingArtifactPath))
 			err := file.Move(workingArtifactPath, finalFile)
 			if err != nil {
 				logger.Log.Errorf("Failed to move (%s) to (%s). Error: %s", workingArtifactPath, finalFile, err)
+				result.err = err
+			} else if options.generateChecksums {
+				err = writeChecksumFile(finalFile)
+				if err != nil {
+					logger.Log.Errorf("Failed to write checksum for (%s). Error: %s", finalFile, err)
+					result.err = err
+				} else {
+					result.convertedFile = finalFile
+				}
 			} else {
 				result.convertedFile = finalFile
 			}
@@ -265,8 +392,58 @@ func artifactConverterWorker(convertRequests chan *convertRequest, convertedResu
 	}
 }
 
-func convertArtifact(artifactName, outDir, format, imageTag, input string, isInputFile, appendExtension bool) (outputFile string, err error) {
-	typeConverter, err := converterFactory(format)
+// writeManifest writes a JSON summary of every conversion result to manifestFile. Failed artifacts are included with
+// a null converted file and the error that caused the failure.
+func writeManifest(manifestFile string, results []*convertResult) (err error) {
+	entries := make([]manifestEntry, 0, len(results))
+	for _, result := range results {
+		entry := manifestEntry{
+			ArtifactName: result.artifactName,
+			Type:         result.artifactType,
+			Compression:  result.compression,
+			OriginalPath: result.originalPath,
+		}
+
+		if result.err != nil {
+			entry.Error = result.err.Error()
+		}
+
+		if result.convertedFile != "" {
+			convertedFile := result.convertedFile
+			entry.ConvertedFile = &convertedFile
+
+			info, statErr := os.Stat(convertedFile)
+			if statErr != nil {
+				return statErr
+			}
+			entry.Size = info.Size()
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return jsonutils.WriteJSONFile(manifestFile, entries)
+}
+
+// writeChecksumFile writes the SHA256 checksum of artifactPath to '<artifactPath>.sha256', using the same
+// '<digest>  <filename>' format as sha256sum so it can be checked with 'sha256sum -c'.
+func writeChecksumFile(artifactPath string) (err error) {
+	const checksumExtension = ".sha256"
+
+	hash, err := file.GenerateSHA256(artifactPath)
+	if err != nil {
+		return
+	}
+
+	checksumLine := fmt.Sprintf("%s  %s\n", hash, filepath.Base(artifactPath))
+	err = file.Write(checksumLine, artifactPath+checksumExtension)
+	return
+}
+
+// convertArtifact converts input into the given format, writing the result to outDir. For a dry run the conversion
+// and the external tools it would run are only logged, and outputFile is the path that would have been written.
+func convertArtifact(artifactName, outDir, format string, options converterOptions, imageTag, input string, isInputFile, appendExtension bool) (outputFile string, err error) {
+	typeConverter, err := converterFactory(format, options)
 	if err != nil {
 		return
 	}
@@ -289,11 +466,68 @@ func convertArtifact(artifactName, outDir, format, imageTag, input string, isInp
 	outputPath := filepath.Join(outDir, artifactName)
 	outputFile = fmt.Sprintf("%s%s%s", outputPath, imageTag, newExt)
 
+	if options.dryRun {
+		logger.Log.Infof("Would convert (%s) to (%s) as (%s) using %s", input, format, outputFile, converterTools(typeConverter))
+		return
+	}
+
 	err = typeConverter.Convert(input, outputFile, isInputFile)
 	return
 }
 
-func converterFactory(formatType string) (converter formats.Converter, err error) {
+// converterTools describes the external tools run by converter, for logging.
+func converterTools(converter formats.Converter) string {
+	toolUser, ok := converter.(formats.ExternalToolUser)
+	if !ok || len(toolUser.Tools()) == 0 {
+		return "no external tools"
+	}
+	return fmt.Sprintf("(%s)", strings.Join(toolUser.Tools(), ", "))
+}
+
+// verifyDelta checks a converted diff or rdiff artifact against the base image it is a delta of. Artifacts that are
+// not deltas are accepted as-is.
+func verifyDelta(req *convertRequest, deltaPath, tmpDir string) (err error) {
+	if req.baseImage == "" {
+		return
+	}
+
+	switch req.artifact.Type {
+	case formats.DiffType:
+		err = formats.NewDiff().Verify(deltaPath)
+	case formats.RdiffType:
+		var expectedSHA256 string
+		expectedSHA256, err = readChecksumFile(req.inputPath + configuration.RdiffTargetChecksumExtension)
+		if err != nil {
+			return fmt.Errorf("failed to read the expected checksum of rdiff delta (%s), it is only written when imager runs with --rdiff-target-checksums:\n%w", req.inputPath, err)
+		}
+		err = formats.NewRdiff().Verify(deltaPath, req.baseImage, expectedSHA256, tmpDir)
+	}
+
+	return
+}
+
+// readChecksumFile returns the digest from a checksum file in the '<digest>  <filename>' format used by sha256sum.
+func readChecksumFile(checksumFile string) (hash string, err error) {
+	contents, err := file.Read(checksumFile)
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(contents)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file (%s) is empty", checksumFile)
+	}
+
+	hash = fields[0]
+	return
+}
+
+// defaultCompressionThreads splits the host's CPUs evenly between the conversion workers.
+func defaultCompressionThreads(workers int) int {
+	return max(runtime.NumCPU()/workers, 1)
+}
+
+func converterFactory(formatType string, options converterOptions) (converter formats.Converter, err error) {
 	switch formatType {
 	case formats.RawType:
 		converter = formats.NewRaw()
@@ -304,27 +538,41 @@ func converterFactory(formatType string) (converter formats.Converter, err error
 	case formats.RdiffType:
 		converter = formats.NewRdiff()
 	case formats.GzipType:
-		converter = formats.NewGzip()
+		converter = formats.NewGzip(options.compressionThreads)
 	case formats.TarGzipType:
 		converter = formats.NewTarGzip()
 	case formats.SquashFSType:
 		converter = formats.NewSquashFS()
 	case formats.XzType:
-		converter = formats.NewXz()
+		converter = formats.NewXz(options.compressionThreads)
 	case formats.TarXzType:
 		converter = formats.NewTarXz()
+	case formats.ZstdType:
+		converter = formats.NewZstd()
+	case formats.TarZstdType:
+		converter = formats.NewTarZstd()
+	case formats.Lz4Type:
+		converter = formats.NewLz4()
+	case formats.TarLz4Type:
+		converter = formats.NewTarLz4()
+	case formats.Bzip2Type:
+		converter = formats.NewBzip2()
+	case formats.TarBzip2Type:
+		converter = formats.NewTarBzip2()
 	case formats.VhdType:
 		const gen2 = false
-		converter = formats.NewVhd(gen2)
+		converter = formats.NewVhd(gen2, options.vhdSubformat)
 	case formats.VhdxType:
 		const gen2 = true
-		converter = formats.NewVhd(gen2)
+		converter = formats.NewVhd(gen2, options.vhdSubformat)
 	case formats.InitrdType:
 		converter = formats.NewInitrd()
 	case formats.OvaType:
 		converter = formats.NewOva()
 	case formats.QcowType:
 		converter = formats.NewQcow()
+	case formats.VmdkType:
+		converter = formats.NewVmdk(options.vmdkSubformat)
 	default:
 		err = fmt.Errorf("unsupported output format: %s", formatType)
 	}
@@ -332,6 +580,22 @@ func converterFactory(formatType string) (converter formats.Converter, err error
 	return
 }
 
+// validateRootfsDisks returns an error if more than one disk has no partitions. The imager produces a single rootfs
+// directory, which every such disk would use as its input.
+func validateRootfsDisks(disks []configuration.Disk) (err error) {
+	rootfsDisks := []int{}
+	for i, disk := range disks {
+		if len(disk.Partitions) == 0 {
+			rootfsDisks = append(rootfsDisks, i)
+		}
+	}
+
+	if len(rootfsDisks) > 1 {
+		err = fmt.Errorf("disks %v have no partitions, but only one rootfs can be converted", rootfsDisks)
+	}
+	return
+}
+
 func diskArtifactInput(diskIndex int, disk configuration.Disk) (input string, isFile bool) {
 	const rootfsPrefix = "rootfs"
 
@@ -346,6 +610,23 @@ func diskArtifactInput(diskIndex int, disk configuration.Disk) (input string, is
 	return
 }
 
+// deltaBaseImage returns the base image of a partition artifact that the imager produced as a delta, or an empty
+// string if the artifact's input is a full partition image.
+func deltaBaseImage(diskPartArtifact *configuration.Artifact, partitionSetting *configuration.PartitionSetting) string {
+	if partitionSetting == nil {
+		return ""
+	}
+
+	switch diskPartArtifact.Type {
+	case formats.DiffType:
+		return partitionSetting.OverlayBaseImage
+	case formats.RdiffType:
+		return partitionSetting.RdiffBaseImage
+	}
+
+	return ""
+}
+
 func partitionArtifactInput(diskIndex, partitionIndex int, diskPartArtifact *configuration.Artifact, partitionSetting *configuration.PartitionSetting) (input string, isFile bool) {
 	// Currently all file artifacts have a raw file for input
 	if diskPartArtifact.Type == "diff" && partitionSetting.OverlayBaseImage != "" {
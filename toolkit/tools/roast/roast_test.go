@@ -0,0 +1,299 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/configuration"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/jsonutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/roast/formats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitStderrLog()
+	os.Exit(m.Run())
+}
+
+func TestAbsoluteDirPathsUsesTmpDir(t *testing.T) {
+	inDirPath, outDirPath, tmpDirPath, err := absoluteDirPaths("in", "out", "tmp")
+	assert.NoError(t, err)
+
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(cwd, "in"), inDirPath)
+	assert.Equal(t, filepath.Join(cwd, "out"), outDirPath)
+	assert.Equal(t, filepath.Join(cwd, "tmp"), tmpDirPath)
+}
+
+func TestGenerateImageArtifactsUsesTmpDir(t *testing.T) {
+	inDir, outDir, tmpDir := t.TempDir(), t.TempDir(), filepath.Join(t.TempDir(), "tmp")
+
+	err := os.WriteFile(filepath.Join(inDir, "disk0.partition0.raw"), []byte("partition contents"), 0o644)
+	assert.NoError(t, err)
+
+	config := configuration.Config{
+		Disks: []configuration.Disk{{
+			Partitions: []configuration.Partition{{
+				ID:        "rootfs",
+				Artifacts: []configuration.Artifact{{Name: "rootfs", Type: "raw", Compression: "gz"}},
+			}},
+		}},
+		SystemConfigs: []configuration.SystemConfig{{
+			PartitionSettings: []configuration.PartitionSetting{{ID: "rootfs"}},
+		}},
+	}
+
+	err = generateImageArtifacts(1, converterOptions{}, inDir, outDir, "", "", tmpDir, config)
+	assert.NoError(t, err)
+
+	// The intermediate, uncompressed artifact is left in the temporary directory, only the final one is moved out.
+	assert.FileExists(t, filepath.Join(tmpDir, "rootfs.raw"))
+	assert.NoFileExists(t, filepath.Join(outDir, "rootfs.raw"))
+	assert.FileExists(t, filepath.Join(outDir, "rootfs.raw.gz"))
+}
+
+func TestGenerateImageArtifactsMultipleDisks(t *testing.T) {
+	inDir, outDir, tmpDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+	inputs := []string{"disk0.raw", "disk1.raw", "disk1.partition0.raw"}
+	for _, input := range inputs {
+		err := os.WriteFile(filepath.Join(inDir, input), []byte(input), 0o644)
+		assert.NoError(t, err)
+	}
+
+	config := configuration.Config{
+		Disks: []configuration.Disk{
+			{
+				Artifacts:  []configuration.Artifact{{Name: "os", Type: "raw"}},
+				Partitions: []configuration.Partition{{ID: "boot"}},
+			},
+			{
+				Artifacts: []configuration.Artifact{{Name: "data", Type: "raw"}},
+				Partitions: []configuration.Partition{{
+					ID:        "var",
+					Artifacts: []configuration.Artifact{{Name: "var", Type: "raw"}},
+				}},
+			},
+		},
+		SystemConfigs: []configuration.SystemConfig{{
+			PartitionSettings: []configuration.PartitionSetting{{ID: "boot"}, {ID: "var"}},
+		}},
+	}
+
+	err := generateImageArtifacts(2, converterOptions{}, inDir, outDir, "", "", tmpDir, config)
+	assert.NoError(t, err)
+
+	expectedOutputs := map[string]string{
+		"os.raw":   "disk0.raw",
+		"data.raw": "disk1.raw",
+		"var.raw":  "disk1.partition0.raw",
+	}
+	for output, input := range expectedOutputs {
+		data, err := os.ReadFile(filepath.Join(outDir, output))
+		assert.NoError(t, err)
+		assert.Equal(t, input, string(data))
+	}
+}
+
+func TestGenerateImageArtifactsMultipleRootfsDisks(t *testing.T) {
+	inDir, outDir, tmpDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+	err := os.Mkdir(filepath.Join(inDir, "rootfs"), 0o755)
+	assert.NoError(t, err)
+
+	config := configuration.Config{
+		Disks: []configuration.Disk{
+			{Artifacts: []configuration.Artifact{{Name: "first", Type: "tar.gz"}}},
+			{Artifacts: []configuration.Artifact{{Name: "second", Type: "tar.gz"}}},
+		},
+	}
+
+	err = generateImageArtifacts(1, converterOptions{}, inDir, outDir, "", "", tmpDir, config)
+	assert.ErrorContains(t, err, "disks [0 1] have no partitions")
+
+	entries, err := os.ReadDir(outDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestGenerateImageArtifactsChecksums(t *testing.T) {
+	const (
+		content = "partition contents"
+		// sha256 of content
+		contentSha256 = "118a417953745daaa5864257f7f7325a72e8efe4c0ff3854ec0546f106e1fd27"
+	)
+	inDir, outDir, tmpDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+	err := os.WriteFile(filepath.Join(inDir, "disk0.partition0.raw"), []byte(content), 0o644)
+	assert.NoError(t, err)
+
+	config := configuration.Config{
+		Disks: []configuration.Disk{{
+			Partitions: []configuration.Partition{{
+				ID:        "rootfs",
+				Artifacts: []configuration.Artifact{{Name: "rootfs", Type: "raw"}},
+			}},
+		}},
+		SystemConfigs: []configuration.SystemConfig{{
+			PartitionSettings: []configuration.PartitionSetting{{ID: "rootfs"}},
+		}},
+	}
+
+	err = generateImageArtifacts(1, converterOptions{generateChecksums: true}, inDir, outDir, "", "", tmpDir, config)
+	assert.NoError(t, err)
+
+	checksum, err := os.ReadFile(filepath.Join(outDir, "rootfs.raw.sha256"))
+	assert.NoError(t, err)
+	assert.Equal(t, contentSha256+"  rootfs.raw\n", string(checksum))
+}
+
+func TestGenerateImageArtifactsManifest(t *testing.T) {
+	const content = "disk contents"
+	inDir, outDir, tmpDir := t.TempDir(), t.TempDir(), t.TempDir()
+	manifestFile := filepath.Join(t.TempDir(), "manifest.json")
+
+	err := os.WriteFile(filepath.Join(inDir, "disk0.raw"), []byte(content), 0o644)
+	assert.NoError(t, err)
+
+	config := configuration.Config{
+		Disks: []configuration.Disk{{
+			Artifacts: []configuration.Artifact{
+				{Name: "good", Type: "raw"},
+				{Name: "bad", Type: "unknown"},
+			},
+			Partitions: []configuration.Partition{{ID: "rootfs"}},
+		}},
+	}
+
+	err = generateImageArtifacts(1, converterOptions{manifestFile: manifestFile}, inDir, outDir, "", "", tmpDir, config)
+	assert.Error(t, err)
+
+	var entries []manifestEntry
+	err = jsonutils.ReadJSONFile(manifestFile, &entries)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	byName := map[string]manifestEntry{}
+	for _, entry := range entries {
+		byName[entry.ArtifactName] = entry
+	}
+
+	good := byName["good"]
+	if assert.NotNil(t, good.ConvertedFile) {
+		assert.Equal(t, filepath.Join(outDir, "good.raw"), *good.ConvertedFile)
+	}
+	assert.Equal(t, "raw", good.Type)
+	assert.Equal(t, int64(len(content)), good.Size)
+	assert.Empty(t, good.Error)
+
+	bad := byName["bad"]
+	assert.Nil(t, bad.ConvertedFile)
+	assert.Contains(t, bad.Error, "unsupported output format")
+}
+
+func TestGenerateImageArtifactsDryRun(t *testing.T) {
+	inDir, outDir, tmpDir := t.TempDir(), filepath.Join(t.TempDir(), "out"), filepath.Join(t.TempDir(), "tmp")
+	manifestFile := filepath.Join(t.TempDir(), "manifest.json")
+
+	err := os.WriteFile(filepath.Join(inDir, "disk0.partition0.raw"), []byte("partition contents"), 0o644)
+	assert.NoError(t, err)
+
+	config := configuration.Config{
+		Disks: []configuration.Disk{{
+			Partitions: []configuration.Partition{{
+				ID:        "rootfs",
+				Artifacts: []configuration.Artifact{{Name: "rootfs", Type: "raw", Compression: "gz"}},
+			}},
+		}},
+		SystemConfigs: []configuration.SystemConfig{{
+			PartitionSettings: []configuration.PartitionSetting{{ID: "rootfs"}},
+		}},
+	}
+
+	err = generateImageArtifacts(1, converterOptions{generateChecksums: true, manifestFile: manifestFile, dryRun: true}, inDir, outDir, "", "", tmpDir, config)
+	assert.NoError(t, err)
+
+	assert.NoDirExists(t, tmpDir)
+	assert.NoDirExists(t, outDir)
+	assert.NoFileExists(t, manifestFile)
+}
+
+func TestGenerateImageArtifactsVerifyDeltas(t *testing.T) {
+	inDir, outDir, tmpDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+	// Not a tarball, so the overlay diff fails verification.
+	err := os.WriteFile(filepath.Join(inDir, "disk0.partition0.diff"), []byte("not a tarball"), 0o644)
+	assert.NoError(t, err)
+
+	config := configuration.Config{
+		Disks: []configuration.Disk{{
+			Partitions: []configuration.Partition{{
+				ID:        "rootfs",
+				Artifacts: []configuration.Artifact{{Name: "rootfs", Type: "diff"}},
+			}},
+		}},
+		SystemConfigs: []configuration.SystemConfig{{
+			PartitionSettings: []configuration.PartitionSetting{{ID: "rootfs", OverlayBaseImage: "base.raw"}},
+		}},
+	}
+
+	err = generateImageArtifacts(1, converterOptions{}, inDir, outDir, "", "", tmpDir, config)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outDir, "rootfs.diff"))
+
+	err = generateImageArtifacts(1, converterOptions{verifyDeltas: true}, inDir, outDir, "", "", tmpDir, config)
+	assert.ErrorContains(t, err, "failed to generate the following artifacts: [rootfs]")
+}
+
+func TestVerifyDeltaRdiffRequiresTargetChecksum(t *testing.T) {
+	inDir := t.TempDir()
+	delta := filepath.Join(inDir, "disk0.partition0.rdiff")
+	err := os.WriteFile(delta, []byte("delta"), 0o644)
+	assert.NoError(t, err)
+
+	req := &convertRequest{
+		inputPath: delta,
+		artifact:  configuration.Artifact{Name: "rootfs", Type: "rdiff"},
+		baseImage: "base.raw",
+	}
+
+	err = verifyDelta(req, delta, t.TempDir())
+	assert.ErrorContains(t, err, "failed to read the expected checksum")
+}
+
+func TestVerifyDeltaSkipsFullImages(t *testing.T) {
+	req := &convertRequest{
+		inputPath: "disk0.partition0.raw",
+		artifact:  configuration.Artifact{Name: "rootfs", Type: "rdiff"},
+	}
+
+	assert.NoError(t, verifyDelta(req, "does-not-exist", t.TempDir()))
+}
+
+func TestReadChecksumFile(t *testing.T) {
+	checksumFile := filepath.Join(t.TempDir(), "image.sha256")
+	err := os.WriteFile(checksumFile, []byte("abc123  image.raw\n"), 0o644)
+	assert.NoError(t, err)
+
+	hash, err := readChecksumFile(checksumFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", hash)
+
+	err = os.WriteFile(checksumFile, []byte("\n"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = readChecksumFile(checksumFile)
+	assert.ErrorContains(t, err, "is empty")
+}
+
+func TestConverterTools(t *testing.T) {
+	assert.Equal(t, "(qemu-img)", converterTools(formats.NewQcow()))
+	assert.Equal(t, "(tar, zstd)", converterTools(formats.NewTarZstd()))
+	assert.Equal(t, "no external tools", converterTools(formats.NewRaw()))
+}